@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/store"
+	"github.com/methol/xui-exporter/internal/version"
+)
+
+// readyMaxRefreshAge is how many refresh intervals may pass since the last
+// refresh of a target before the exporter reports not ready
+const readyMaxRefreshAge = 3
+
+// healthzHandler reports that the process is alive
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
+
+// readyzHandler reports ready once every target has been refreshed (whether
+// it is up or not) and no refresh is older than readyMaxRefreshAge of the
+// target's refresh intervals
+func (e *exporter) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := make(map[string]store.TargetStatus)
+	for _, status := range e.store.GetTargets() {
+		statuses[status.Target] = status
+	}
+
+	for _, t := range e.current().targets {
+		status, ok := statuses[t.label]
+		if !ok {
+			http.Error(w, fmt.Sprintf("target %s not refreshed yet", t.label), http.StatusServiceUnavailable)
+			return
+		}
+
+		age := time.Since(time.Unix(int64(status.LastRefreshTimestampSeconds), 0))
+		maxAge := readyMaxRefreshAge * t.RefreshInterval
+		if age > maxAge {
+			http.Error(w, fmt.Sprintf("target %s last refreshed %s ago (max %s)", t.label, age.Round(time.Second), maxAge), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+// versionHandler serves the build information as JSON
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version.Get()); err != nil {
+		log.Printf("Failed to write version: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	e, _ := newTestExporter(t, `
+refresh_interval: 1m
+targets:
+  - name: a
+    url: https://example.com/sub/sid-a
+  - name: b
+    url: https://example.com/sub/sid-b
+`)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		e.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	refreshed := func(label string, at time.Time) {
+		e.store.UpdateTarget(nil, store.TargetStatus{
+			Target:                      label,
+			RefreshInterval:             time.Minute,
+			LastRefreshTimestampSeconds: float64(at.Unix()),
+		})
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before the first refresh, got %d", code)
+	}
+
+	// A failed refresh counts, but every target needs one
+	refreshed("a", time.Now())
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while target b was not refreshed, got %d", code)
+	}
+
+	refreshed("b", time.Now())
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected status 200 once every target was refreshed, got %d", code)
+	}
+
+	refreshed("b", time.Now().Add(-readyMaxRefreshAge*time.Minute-time.Second))
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 once a refresh is older than %d intervals, got %d", readyMaxRefreshAge, code)
+	}
+}
@@ -2,169 +2,146 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/api"
 	"github.com/methol/xui-exporter/internal/config"
-	"github.com/methol/xui-exporter/internal/fetch"
 	"github.com/methol/xui-exporter/internal/metrics"
-	"github.com/methol/xui-exporter/internal/parse"
+	"github.com/methol/xui-exporter/internal/redact"
+	"github.com/methol/xui-exporter/internal/status"
 	"github.com/methol/xui-exporter/internal/store"
+	"github.com/methol/xui-exporter/internal/version"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-const (
-	listenAddr       = ":9100"
-	metricsPath      = "/metrics"
-	refreshInterval  = 60 * time.Second
-	fetchConcurrency = 4
-)
+// shutdownTimeout bounds draining HTTP requests and stopping the refresh loop on shutdown
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	// Parse targets from environment variable
-	targets, err := config.ParseTargetsFromEnv()
+	configFile := flag.String("config.file", os.Getenv("XUI_EXPORTER_CONFIG_FILE"), "Path to a YAML/JSON configuration file (env XUI_EXPORTER_CONFIG_FILE)")
+	flag.Parse()
+
+	// Log through a writer that masks URLs once privacy mode is enabled
+	logs := redact.NewWriter(os.Stderr)
+	log.SetOutput(logs)
+
+	info := version.Get()
+	log.Printf("Starting xui-exporter %s (revision %s, %s)", info.Version, info.Revision, info.GoVersion)
+
+	// Load configuration from file and environment
+	cfg, err := config.Load(*configFile)
 	if err != nil {
 		log.Fatalf("Configuration error: %v", err)
 	}
+	for _, warning := range cfg.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
 
-	log.Printf("Loaded %d target(s) from XUI_EXPORTER_TARGETS", len(targets))
-
-	// Initialize store
+	// Initialize store, restoring the last snapshot if a state file is configured
 	st := store.New()
+	st.SetGracePeriod(cfg.StaleGracePeriod)
+	st.SetUsageWindows(cfg.UsageRateWindows)
+	st.SetPrivacyFingerprint(cfg.Privacy.Fingerprint())
+	if cfg.StateFile != "" {
+		restored, err := st.LoadFile(cfg.StateFile)
+		if err != nil {
+			log.Printf("Failed to restore state from %s: %v", cfg.StateFile, err)
+		} else if restored > 0 {
+			log.Printf("Restored %d subscription(s) from %s (stale until refreshed)", restored, cfg.StateFile)
+		}
+	}
+
+	ex, err := newExporter(*configFile, cfg, st, logs)
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	log.Printf("Loaded %d target(s)", len(cfg.Targets))
+
+	// Drop restored subscriptions of targets that are no longer configured
+	st.RetainTargets(ex.current().targetLabels())
 
 	// Create and register custom collector
 	collector := metrics.NewCollector(st)
 	prometheus.MustRegister(collector)
+	metrics.RegisterExporterMetrics(prometheus.DefaultRegisterer)
+	metrics.ConfigLastReloadSuccessful.Set(1)
+	metrics.ConfigLastReloadSuccessTimestampSeconds.SetToCurrentTime()
 
 	log.Printf("Registered Prometheus collector")
 
-	// Perform initial refresh before starting server
-	log.Printf("Performing initial refresh...")
-	refresh(targets, st)
-
-	// Start refresh loop in background
-	go refreshLoop(targets, st, refreshInterval)
+	// Cancel the root context on SIGINT/SIGTERM; it stops the refresh loop
+	// and aborts in-flight fetches
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start refresh loop in background (each target is first refreshed within
+	// a tenth of its interval, while restored state is already served)
+	refreshDone := make(chan struct{})
+	go func() {
+		ex.refreshLoop(ctx)
+		close(refreshDone)
+	}()
+
+	// Reload configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := ex.reload(); err != nil {
+				log.Printf("Configuration reload failed: %v", err)
+			}
+		}
+	}()
 
 	// Start HTTP server
-	http.Handle(metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintf(w, `<html>
-<head><title>XUI Exporter</title></head>
-<body>
-<h1>XUI Exporter</h1>
-<p><a href="%s">Metrics</a></p>
-</body>
-</html>`, metricsPath)
-	})
-
-	log.Printf("Starting HTTP server on %s", listenAddr)
-	log.Printf("Metrics available at %s%s", listenAddr, metricsPath)
-
-	if err := http.ListenAndServe(listenAddr, nil); err != nil {
+	http.Handle(cfg.MetricsPath, promhttp.Handler())
+	http.HandleFunc("/probe", ex.probeHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", ex.readyzHandler)
+	http.HandleFunc("/version", versionHandler)
+	http.Handle("/api/", api.NewHandler(st))
+	http.HandleFunc("/-/reload", ex.reloadHandler)
+	http.Handle("/", status.NewHandler(st, cfg.MetricsPath, ex.configuredTargets))
+
+	log.Printf("Starting HTTP server on %s", cfg.ListenAddress)
+	log.Printf("Metrics available at %s%s", cfg.ListenAddress, cfg.MetricsPath)
+
+	server := &http.Server{Addr: cfg.ListenAddress}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("HTTP server error: %v", err)
+	case <-ctx.Done():
 	}
-}
-
-// refreshLoop runs the refresh process on a ticker
-func refreshLoop(targets []string, st *store.Store, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		refresh(targets, st)
-	}
-}
-
-// refresh fetches all targets concurrently and updates the store
-func refresh(targets []string, st *store.Store) {
-	refreshStart := time.Now()
-	log.Printf("Starting refresh cycle for %d target(s)", len(targets))
+	// A second signal kills the process right away
+	stop()
+	log.Printf("Shutting down")
 
-	// Create new snapshot map
-	newSnapshot := make(map[string]compute.SubscriptionMetrics)
-	var mu sync.Mutex
-
-	// Semaphore for concurrency control
-	sem := make(chan struct{}, fetchConcurrency)
-	var wg sync.WaitGroup
-
-	for _, target := range targets {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			fetchAndProcess(url, refreshStart, &newSnapshot, &mu)
-		}(target)
-	}
-
-	// Wait for all fetches to complete
-	wg.Wait()
-
-	// Atomically swap snapshot
-	st.SetSnapshot(newSnapshot)
-
-	duration := time.Since(refreshStart)
-	log.Printf("Refresh cycle completed in %v, collected %d subscription(s)", duration, len(newSnapshot))
-}
-
-// fetchAndProcess fetches a single target, parses it, and adds to snapshot
-func fetchAndProcess(url string, refreshStart time.Time, snapshot *map[string]compute.SubscriptionMetrics, mu *sync.Mutex) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	// Drain in-flight requests, then wait for the refresh loop to stop
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
-
-	// Fetch HTML
-	htmlBytes, err := fetch.GetHTML(ctx, url)
-	if err != nil {
-		log.Printf("Failed to fetch %s: %v", url, err)
-		return
-	}
-
-	// Parse subscription data
-	parsed, err := parse.ParseSubscription(htmlBytes)
-	if err != nil {
-		// Log error with HTML preview for debugging
-		preview := string(htmlBytes)
-		if len(preview) > 500 {
-			preview = preview[:500] + "..."
-		}
-		log.Printf("Failed to parse %s: %v\nHTML preview (first 500 chars): %s", url, err, preview)
-		return
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
 	}
 
-	sid := parsed.SID
-
-	// Validate quota (quota=0 is treated as failure)
-	if parsed.TotalByte == 0 {
-		log.Printf("Validation failed for %s (sid=%s): quota is 0 (not allowed)", url, sid)
-		mu.Lock()
-		(*snapshot)[sid] = compute.NewFailedMetrics(sid, refreshStart)
-		mu.Unlock()
-		return
-	}
-
-	// Compute metrics
-	now := time.Now()
-	metricsData := compute.Compute(now, parsed, refreshStart)
-
-	// Add to snapshot (last write wins on sid collision)
-	mu.Lock()
-	if existing, exists := (*snapshot)[sid]; exists {
-		log.Printf("Warning: SID %s appears in multiple targets, last write wins (previous from %s)", sid, url)
-		// Check if we're overwriting - just for logging
-		_ = existing
+	select {
+	case <-refreshDone:
+	case <-shutdownCtx.Done():
+		log.Printf("Refresh loop did not stop within %v", shutdownTimeout)
 	}
-	(*snapshot)[sid] = metricsData
-	mu.Unlock()
 
-	log.Printf("Successfully processed %s (sid=%s)", url, sid)
+	// Flush the last complete snapshot
+	ex.saveState()
+	log.Printf("Shutdown complete")
 }
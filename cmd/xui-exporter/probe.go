@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/metrics"
+	"github.com/methol/xui-exporter/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeTimeoutOffset is subtracted from Prometheus' scrape timeout so the
+// probe answers before Prometheus gives up
+const probeTimeoutOffset = 500 * time.Millisecond
+
+// probeHandler serves /probe?target=<url>, blackbox_exporter style.
+// It runs fetch, parse and compute synchronously for one target and returns
+// its metrics through a dedicated registry, without touching the background store.
+// target may also be the name of a configured target, whose settings are then used.
+func (e *exporter) probeHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("target")
+	if raw == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	t, err := e.probeTarget(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer t.client.CloseIdleConnections()
+
+	// Honor Prometheus' scrape timeout if it is shorter than the target timeout
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			scrapeTimeout := time.Duration(seconds*float64(time.Second)) - probeTimeoutOffset
+			if scrapeTimeout > 0 && scrapeTimeout < t.Timeout {
+				t.Timeout = scrapeTimeout
+			}
+		}
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Whether the probe succeeded (1=success, 0=failure)",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Duration of the probe in seconds",
+	})
+
+	start := time.Now()
+	snapshot, status := fetchAndProcess(r.Context(), t, start)
+
+	status.Target = t.label
+	status.LastRefreshTimestampSeconds = float64(time.Now().Unix())
+	status.RefreshDurationSeconds = time.Since(start).Seconds()
+	probeDuration.Set(status.RefreshDurationSeconds)
+	if status.Up {
+		probeSuccess.Set(1)
+	}
+
+	st := store.New()
+	st.SetSnapshot(snapshot, []store.TargetStatus{status})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewCollector(st), probeSuccess, probeDuration)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// probeTarget resolves the target parameter of a probe: a configured target
+// (by URL or name) keeps its settings, any other URL gets the global settings.
+// The probe gets its own client either way, so it does not count towards the
+// background refresh's fetch metrics and retries.
+func (e *exporter) probeTarget(raw string) (target, error) {
+	rt := e.current()
+	onRetry := func(attempt int, err error) {
+		log.Printf("Retrying probe of %s (retry %d): %v", raw, attempt, err)
+	}
+
+	for _, t := range rt.targets {
+		if t.URL == raw || t.label == raw {
+			return newTarget(rt.cfg, t.Target, nil, onRetry)
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return target{}, fmt.Errorf("target must be an absolute http(s) URL or a configured target name")
+	}
+
+	return newTarget(rt.cfg, rt.cfg.TargetFor(raw), nil, onRetry)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probe serves a /probe request for target with the given request headers
+func probe(e *exporter, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(target), nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.probeHandler(rec, req)
+	return rec
+}
+
+func TestProbeHandler(t *testing.T) {
+	server := newSubscriptionServer(t)
+	e, _ := newTestExporter(t, fmt.Sprintf(`
+targets:
+  - name: configured
+    url: %s/sid-configured
+`, server.URL))
+
+	rec := probe(e, server.URL+"/sid-adhoc", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`xui_subscription_up{sid="sid-adhoc"} 1`, "probe_success 1", "probe_duration_seconds"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected probe output to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	// Configured targets are resolved by name, with their settings
+	body = probe(e, "configured", nil).Body.String()
+	for _, want := range []string{`xui_subscription_up{sid="sid-configured"} 1`, `xui_target_up{target="configured"} 1`, "probe_success 1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected probe of the configured target to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	// Probes do not touch the background store
+	if len(e.store.GetSnapshot()) != 0 || len(e.store.GetTargets()) != 0 {
+		t.Error("Expected the probes to leave the store empty")
+	}
+}
+
+func TestProbeHandler_BadRequest(t *testing.T) {
+	e, _ := newTestExporter(t, "targets:\n  - url: https://example.com/sub/sid1\n")
+
+	for name, target := range map[string]string{
+		"missing":  "",
+		"non-http": "ftp://example.com/sub/sid1",
+		"relative": "/sub/sid1",
+	} {
+		if rec := probe(e, target, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, rec.Code)
+		}
+	}
+}
+
+func TestProbeHandler_ScrapeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	e, _ := newTestExporter(t, fmt.Sprintf(`
+retry:
+  max_retries: -1
+targets:
+  - name: slow
+    url: %s/sid-slow
+    timeout: 10s
+`, server.URL))
+
+	// The 1s scrape timeout leaves 500ms for the probe instead of 10s
+	start := time.Now()
+	rec := probe(e, "slow", http.Header{"X-Prometheus-Scrape-Timeout-Seconds": {"1"}})
+	elapsed := time.Since(start)
+
+	if elapsed > 3*time.Second {
+		t.Errorf("Expected the probe to give up after the scrape timeout, took %v", elapsed)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "probe_success 0") || !strings.Contains(body, `reason="timeout"`) {
+		t.Errorf("Expected a failed probe with reason timeout, got:\n%s", body)
+	}
+}
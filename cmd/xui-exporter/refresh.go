@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/config"
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/metrics"
+	"github.com/methol/xui-exporter/internal/parse"
+	"github.com/methol/xui-exporter/internal/redact"
+	"github.com/methol/xui-exporter/internal/source"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+// bodyPreviewLength is the length of the body preview logged on parse errors
+const bodyPreviewLength = 500
+
+// startJitterFraction bounds the random start offset of each target's
+// schedule as a fraction of its refresh interval, so targets sharing an
+// interval do not refresh in lockstep
+const startJitterFraction = 0.1
+
+// scheduler refreshes a single target on its own interval
+type scheduler struct {
+	target target
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop cancels the scheduler and waits until its in-flight refresh has stopped
+func (s *scheduler) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// refreshLoop runs one scheduler per target until ctx is cancelled. After a
+// configuration reload, schedulers of changed or removed targets are stopped
+// and new ones started, while unchanged targets keep their schedule.
+// It returns once every in-flight refresh has stopped.
+func (e *exporter) refreshLoop(ctx context.Context) {
+	running := make(map[string]*scheduler)
+	defer func() {
+		for _, s := range running {
+			s.stop()
+		}
+	}()
+
+	e.schedule(ctx, running, true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.reloaded:
+			e.schedule(ctx, running, false)
+		}
+	}
+}
+
+// schedule reconciles the running schedulers with the current targets.
+// Targets are started with a jittered offset at startup and right away after
+// a reload. Schedulers of removed and changed targets are stopped before the
+// store is cleaned up, so none of them writes back stale data: metrics of
+// removed targets are dropped, and so are the subscriptions of targets whose
+// privacy settings changed, since they are keyed by the previous SIDs.
+func (e *exporter) schedule(ctx context.Context, running map[string]*scheduler, jitter bool) {
+	rt := e.current()
+	keep := rt.targetLabels()
+
+	var removed []string
+	for label, s := range running {
+		if !keep[label] {
+			s.stop()
+			delete(running, label)
+			removed = append(removed, label)
+		}
+	}
+
+	rekeyed := make(map[string]bool)
+	for _, t := range rt.targets {
+		s, ok := running[t.label]
+		if !ok || sameSettings(s.target, t) {
+			continue
+		}
+		s.stop()
+		delete(running, t.label)
+		if !reflect.DeepEqual(s.target.privacy, t.privacy) {
+			rekeyed[t.label] = true
+		}
+	}
+
+	if len(removed) > 0 {
+		dropped := e.store.RetainTargets(keep)
+		for _, label := range removed {
+			metrics.DeleteTarget(label)
+		}
+		log.Printf("Stopped %d removed target(s), dropped %d subscription(s)", len(removed), dropped)
+	}
+
+	if len(rekeyed) > 0 {
+		dropped := e.store.DropSubscriptions(rekeyed)
+		log.Printf("Privacy settings changed, dropped %d subscription(s) keyed by the previous SIDs", dropped)
+	}
+
+	if len(removed) > 0 || len(rekeyed) > 0 {
+		e.saveState()
+	}
+
+	started := 0
+	for _, t := range rt.targets {
+		if _, ok := running[t.label]; ok {
+			continue
+		}
+
+		var delay time.Duration
+		if jitter {
+			delay = startJitter(t.RefreshInterval)
+		}
+		running[t.label] = e.startScheduler(ctx, t, delay)
+		started++
+	}
+
+	if started > 0 {
+		log.Printf("Scheduled %d target(s)", started)
+	}
+}
+
+// sameSettings reports whether a running target can keep its scheduler for
+// the reloaded target b: its configuration and privacy settings are unchanged
+func sameSettings(a, b target) bool {
+	return reflect.DeepEqual(a.Target, b.Target) && reflect.DeepEqual(a.privacy, b.privacy)
+}
+
+// startJitter returns a random start offset for a target refreshed every interval
+func startJitter(interval time.Duration) time.Duration {
+	limit := time.Duration(float64(interval) * startJitterFraction)
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// startScheduler starts refreshing t after delay, then on its refresh interval
+func (e *exporter) startScheduler(ctx context.Context, t target, delay time.Duration) *scheduler {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &scheduler{
+		target: t,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		ticker := time.NewTicker(t.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			e.refreshTarget(ctx, t)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return s
+}
+
+// refreshTarget fetches a single target and updates its subscriptions in the
+// store right away, then persists the snapshot if a state file is configured.
+// The number of concurrent fetches across targets is bounded by the
+// concurrency setting. A refresh interrupted by cancelling ctx is discarded,
+// so shutting down or reloading does not mark the target as failed.
+func (e *exporter) refreshTarget(ctx context.Context, t target) {
+	sem := e.current().sem
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-sem }()
+
+	start := time.Now()
+	subscriptions, status := fetchAndProcess(ctx, t, start)
+	if ctx.Err() != nil {
+		log.Printf("Refresh of %s interrupted, keeping its previous values", t.URL)
+		return
+	}
+
+	duration := time.Since(start)
+	status.Target = t.label
+	status.LastRefreshTimestampSeconds = float64(time.Now().Unix())
+	status.RefreshDurationSeconds = duration.Seconds()
+	status.RefreshInterval = t.RefreshInterval
+
+	for _, key := range e.store.UpdateTarget(subscriptions, status) {
+		log.Printf("Warning: SID %s appears in multiple targets, last write wins (now from %s)", subscriptions[key].SID, t.URL)
+	}
+
+	metrics.RefreshDurationSeconds.WithLabelValues(t.label).Observe(duration.Seconds())
+	if status.Up {
+		metrics.LastSuccessfulRefreshTimestampSeconds.WithLabelValues(t.label).SetToCurrentTime()
+	} else {
+		metrics.RefreshErrorsTotal.WithLabelValues(t.label, status.Reason).Inc()
+	}
+	e.cycle.add(t.label, start, status.Up, e.current().targetLabels())
+
+	e.saveState()
+}
+
+// refreshCycle tracks rounds of refreshes over all targets. Targets refresh on
+// their own schedules, so a cycle ends once every configured target has
+// refreshed since it started; it feeds the cycle metrics.
+type refreshCycle struct {
+	mu        sync.Mutex
+	start     time.Time
+	refreshed map[string]bool
+	allUp     bool
+}
+
+// add records a refresh of target that started at start, and ends the cycle
+// if every target in targets has refreshed since the cycle started
+func (c *refreshCycle) add(target string, start time.Time, up bool, targets map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.refreshed) == 0 {
+		c.start = start
+		c.refreshed = make(map[string]bool, len(targets))
+		c.allUp = true
+	}
+	c.refreshed[target] = true
+	c.allUp = c.allUp && up
+
+	for label := range targets {
+		if !c.refreshed[label] {
+			return
+		}
+	}
+
+	metrics.RefreshCycleDurationSeconds.Observe(time.Since(c.start).Seconds())
+	if c.allUp {
+		metrics.LastSuccessfulRefreshCycleTimestampSeconds.SetToCurrentTime()
+	}
+	c.refreshed = nil
+}
+
+// saveState persists the snapshot if a state file is configured
+func (e *exporter) saveState() {
+	stateFile := e.current().cfg.StateFile
+	if stateFile == "" {
+		return
+	}
+	if err := e.store.SaveFile(stateFile); err != nil {
+		log.Printf("Failed to save state to %s: %v", stateFile, err)
+	}
+}
+
+// fetchAndProcess fetches a single target, parses it, and computes its subscriptions
+// Returns the subscriptions keyed by SubscriptionMetrics.Key and the target
+// status with Up, Reason and TLS fields set; the caller fills in the rest
+func fetchAndProcess(ctx context.Context, t target, refreshStart time.Time) (map[string]compute.SubscriptionMetrics, store.TargetStatus) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	url := t.URL
+	snapshot := make(map[string]compute.SubscriptionMetrics)
+
+	status := store.TargetStatus{Labels: t.Labels}
+	resp, subscriptions, reason := fetchSubscriptions(ctx, t)
+	if resp != nil && !resp.CertNotAfter.IsZero() {
+		status.TLSCertExpiryTimestampSeconds = float64(resp.CertNotAfter.Unix())
+	}
+	if reason != "" {
+		status.Reason = reason
+		return snapshot, status
+	}
+
+	valid := 0
+	for _, parsed := range subscriptions {
+		parsed = pseudonymize(parsed, t.privacy)
+		sid := parsed.SID
+
+		// Validate quota and expiry (0 means unlimited/never, only allowed when opted in)
+		if err := validateLimits(parsed, *t.AllowUnlimited); err != nil {
+			log.Printf("Validation failed for %s (sid=%s): %v", url, sid, err)
+			failed := compute.NewFailedMetrics(sid, refreshStart)
+			failed.Target = t.label
+			failed.Labels = parsed.Labels
+			failed.TargetLabels = t.Labels
+			failed.Info = compute.NewInfo(parsed, t.label, t.InfoLabels)
+			snapshot[failed.Key()] = failed
+			continue
+		}
+
+		// Compute metrics
+		now := time.Now()
+		metricsData := compute.Compute(now, parsed, refreshStart)
+		metricsData.Target = t.label
+		metricsData.TargetLabels = t.Labels
+		metricsData.Info = compute.NewInfo(parsed, t.label, t.InfoLabels)
+
+		// Add to snapshot (last write wins on sid collision)
+		if _, exists := snapshot[metricsData.Key()]; exists {
+			log.Printf("Warning: SID %s appears more than once in %s, last write wins", sid, url)
+		}
+		snapshot[metricsData.Key()] = metricsData
+		valid++
+	}
+
+	// A target whose subscriptions all failed validation is down
+	if len(subscriptions) > 0 && valid == 0 {
+		status.Reason = store.ReasonValidation
+		return snapshot, status
+	}
+
+	log.Printf("Successfully processed %s (%d subscription(s))", url, len(subscriptions))
+	status.Up = true
+	return snapshot, status
+}
+
+// fetchSubscriptions fetches and parses a target with the source of its type
+// Returns the response (if the fetch succeeded) and the parsed subscriptions,
+// or a store.Reason* constant on failure. When the fetch failed because the
+// certificate did not verify, the response only holds CertNotAfter.
+func fetchSubscriptions(ctx context.Context, t target) (*fetch.Response, []parse.ParsedSubscription, string) {
+	url := t.URL
+	st := source.Target{
+		URL:    url,
+		Client: t.client,
+		Panel: fetch.PanelCredentials{
+			Username:       t.Panel.Username,
+			Password:       t.Panel.Password,
+			TwoFactorToken: t.Panel.TwoFactorToken,
+		},
+		Options: parse.Options{AllowUnlimited: *t.AllowUnlimited},
+	}
+
+	resp, err := t.source.Fetch(ctx, st)
+	if err != nil {
+		log.Printf("Failed to fetch %s: %v", url, err)
+
+		// Keep the expiry of a certificate that failed verification, e.g. an expired one
+		var failed *fetch.Response
+		if notAfter, ok := fetch.FailedCertNotAfter(err); ok {
+			failed = &fetch.Response{CertNotAfter: notAfter}
+		}
+		return failed, nil, fetchErrorReason(err)
+	}
+
+	subscriptions, warnings, err := t.source.Parse(st, resp)
+	for _, warning := range warnings {
+		log.Printf("Warning: %s: %s", url, warning)
+	}
+	if err != nil {
+		// Log error with body preview for debugging. In privacy mode the body
+		// may contain SIDs and tokens, so only its length and type are logged.
+		if t.privacy.Enabled {
+			log.Printf("Failed to parse %s (type %s): %v\nBody: %d bytes, Content-Type %q", url, t.Type, err, len(resp.Body), resp.Header.Get("Content-Type"))
+			return resp, nil, store.ReasonParse
+		}
+		preview := string(resp.Body)
+		if len(preview) > bodyPreviewLength {
+			preview = preview[:bodyPreviewLength] + "..."
+		}
+		log.Printf("Failed to parse %s (type %s): %v\nBody preview (first %d chars): %s", url, t.Type, err, bodyPreviewLength, preview)
+		return resp, nil, store.ReasonParse
+	}
+
+	return resp, subscriptions, ""
+}
+
+// pseudonymize replaces the SID of parsed by its alias or keyed hash and
+// redacts its subscription URL when privacy mode is enabled
+func pseudonymize(parsed parse.ParsedSubscription, privacy config.PrivacyConfig) parse.ParsedSubscription {
+	if !privacy.Enabled {
+		return parsed
+	}
+
+	parsed.SID = privacy.SID(parsed.SID)
+	if parsed.SubURL != "" {
+		parsed.SubURL = redact.URL(parsed.SubURL)
+	}
+	return parsed
+}
+
+// validateLimits checks the quota and expiry of a parsed subscription. Sources
+// such as the panel API report them unvalidated.
+func validateLimits(parsed parse.ParsedSubscription, allowUnlimited bool) error {
+	switch {
+	case parsed.TotalByte < 0 || (parsed.TotalByte == 0 && !allowUnlimited):
+		return fmt.Errorf("quota is %d (not allowed)", parsed.TotalByte)
+	case parsed.Expire < 0 || (parsed.Expire == 0 && !allowUnlimited && !parsed.ExpiryNotStarted):
+		return fmt.Errorf("expire is %d (not allowed)", parsed.Expire)
+	}
+	return nil
+}
+
+// fetchErrorReason classifies a fetch error into a store.Reason* constant
+func fetchErrorReason(err error) string {
+	var statusErr *fetch.StatusError
+	var loginErr *fetch.LoginError
+	switch {
+	case errors.As(err, &loginErr):
+		return store.ReasonAuth
+	case errors.As(err, &statusErr):
+		return store.ReasonHTTPStatus
+	case fetch.IsTimeout(err):
+		return store.ReasonTimeout
+	default:
+		return store.ReasonNetwork
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/config"
+	"github.com/methol/xui-exporter/internal/parse"
+	"github.com/methol/xui-exporter/internal/redact"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+// newSubscriptionServer serves a subscription page whose SID is the request path
+func newSubscriptionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	expire := time.Now().Add(30 * 24 * time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sid := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `<html><body><template id="subscription-data" data-sid="%s" data-downloadbyte="100" data-uploadbyte="50" data-totalbyte="1000" data-expire="%d"></template></body></html>`, sid, expire)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestExporter writes content as the config file and creates an exporter for it
+func newTestExporter(t *testing.T, content string) (*exporter, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	e, err := newExporter(path, cfg, store.New(), redact.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatalf("newExporter failed: %v", err)
+	}
+	return e, path
+}
+
+// waitForRefresh waits until every label in labels has a target status
+// refreshed after since
+func waitForRefresh(t *testing.T, st *store.Store, since time.Time, labels ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		refreshed := make(map[string]bool)
+		for _, status := range st.GetTargets() {
+			if status.LastRefreshTimestampSeconds >= float64(since.Unix()) {
+				refreshed[status.Target] = true
+			}
+		}
+
+		missing := 0
+		for _, label := range labels {
+			if !refreshed[label] {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d of %v to refresh", missing, labels)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartJitter(t *testing.T) {
+	interval := time.Minute
+	limit := time.Duration(float64(interval) * startJitterFraction)
+	for range 100 {
+		if d := startJitter(interval); d < 0 || d >= limit {
+			t.Fatalf("Expected jitter in [0, %v), got %v", limit, d)
+		}
+	}
+
+	if d := startJitter(0); d != 0 {
+		t.Errorf("Expected no jitter for a zero interval, got %v", d)
+	}
+}
+
+func TestSchedule_JitteredStart(t *testing.T) {
+	server := newSubscriptionServer(t)
+	e, _ := newTestExporter(t, fmt.Sprintf(`
+refresh_interval: 1h
+targets:
+  - name: a
+    url: %s/sid-a
+`, server.URL))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := make(map[string]*scheduler)
+	defer func() {
+		cancel()
+		for _, s := range running {
+			s.stop()
+		}
+	}()
+
+	// The first refresh is delayed by up to 6 minutes, so nothing has run yet
+	e.schedule(ctx, running, true)
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := running["a"]; !ok {
+		t.Fatal("Expected a scheduler for target a")
+	}
+	if targets := e.store.GetTargets(); len(targets) != 0 {
+		t.Errorf("Expected no refresh before the jittered start, got %+v", targets)
+	}
+}
+
+func TestSchedule_Reload(t *testing.T) {
+	server := newSubscriptionServer(t)
+	e, path := newTestExporter(t, fmt.Sprintf(`
+refresh_interval: 1h
+targets:
+  - name: same
+    url: %[1]s/sid-same
+  - name: changed
+    url: %[1]s/sid-changed
+  - name: removed
+    url: %[1]s/sid-removed
+`, server.URL))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := make(map[string]*scheduler)
+	defer func() {
+		cancel()
+		for _, s := range running {
+			s.stop()
+		}
+	}()
+
+	start := time.Now()
+	e.schedule(ctx, running, false)
+	waitForRefresh(t, e.store, start, "same", "changed", "removed")
+
+	same, changed := running["same"], running["changed"]
+
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`
+refresh_interval: 1h
+targets:
+  - name: same
+    url: %[1]s/sid-same
+  - name: changed
+    url: %[1]s/sid-changed
+    labels:
+      owner: alice
+`, server.URL)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	// Let the refresh timestamps (whole seconds) tell the restarted refresh apart
+	time.Sleep(time.Until(start.Truncate(time.Second).Add(time.Second)))
+	reloadStart := time.Now()
+	e.schedule(ctx, running, false)
+
+	if running["same"] != same {
+		t.Error("Expected the unchanged target to keep its scheduler")
+	}
+	if running["changed"] == changed || running["changed"] == nil {
+		t.Error("Expected the changed target to get a new scheduler")
+	} else if running["changed"].target.Labels["owner"] != "alice" {
+		t.Errorf("Expected the new scheduler to use the reloaded target, got labels %v", running["changed"].target.Labels)
+	}
+	if _, ok := running["removed"]; ok {
+		t.Error("Expected the scheduler of the removed target to be stopped")
+	}
+
+	// The changed target is fetched right away
+	waitForRefresh(t, e.store, reloadStart, "changed")
+
+	for _, status := range e.store.GetTargets() {
+		if status.Target == "removed" {
+			t.Errorf("Expected the status of the removed target to be dropped, got %+v", status)
+		}
+	}
+	for _, m := range e.store.GetSnapshot() {
+		if m.Target == "removed" {
+			t.Errorf("Expected the subscriptions of the removed target to be dropped, got %+v", m)
+		}
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		parsed         parse.ParsedSubscription
+		allowUnlimited bool
+		ok             bool
+	}{
+		{"limited", parse.ParsedSubscription{TotalByte: 100, Expire: 1700000000}, false, true},
+		{"unlimited quota", parse.ParsedSubscription{TotalByte: 0, Expire: 1700000000}, false, false},
+		{"unlimited quota allowed", parse.ParsedSubscription{TotalByte: 0, Expire: 1700000000}, true, true},
+		{"never expires", parse.ParsedSubscription{TotalByte: 100, Expire: 0}, false, false},
+		{"expiry not started", parse.ParsedSubscription{TotalByte: 100, Expire: 0, ExpiryNotStarted: true}, false, true},
+		{"negative expire", parse.ParsedSubscription{TotalByte: 100, Expire: -1}, true, false},
+	}
+
+	for _, tt := range tests {
+		if err := validateLimits(tt.parsed, tt.allowUnlimited); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got error %v", tt.name, tt.ok, err)
+		}
+	}
+}
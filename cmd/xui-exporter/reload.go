@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/methol/xui-exporter/internal/config"
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/metrics"
+	"github.com/methol/xui-exporter/internal/redact"
+	"github.com/methol/xui-exporter/internal/source"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+// target is a configured target with its resolved label, HTTP client and source
+type target struct {
+	config.Target
+	label   string
+	client  *fetch.Client
+	source  source.Source
+	privacy config.PrivacyConfig
+}
+
+// runtimeConfig is an immutable view of a loaded configuration and its targets
+type runtimeConfig struct {
+	cfg     *config.Config
+	targets []target
+
+	// sem bounds the number of concurrent target refreshes
+	sem chan struct{}
+}
+
+// exporter holds the live configuration shared by the target schedulers and
+// the reload triggers (SIGHUP and POST /-/reload)
+type exporter struct {
+	configFile string
+	store      *store.Store
+
+	// logs masks URLs in log lines while privacy mode is enabled
+	logs *redact.Writer
+
+	mu       sync.RWMutex
+	rt       *runtimeConfig
+	reloadMu sync.Mutex
+
+	// reloaded wakes the refresh loop after a successful reload
+	reloaded chan struct{}
+
+	// cycle tracks the current round of refreshes over all targets
+	cycle refreshCycle
+}
+
+// newExporter creates an exporter serving the given initial configuration
+func newExporter(configFile string, cfg *config.Config, st *store.Store, logs *redact.Writer) (*exporter, error) {
+	rt, err := newRuntimeConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logs.SetEnabled(cfg.Privacy.Enabled)
+
+	return &exporter{
+		configFile: configFile,
+		store:      st,
+		logs:       logs,
+		rt:         rt,
+		reloaded:   make(chan struct{}, 1),
+	}, nil
+}
+
+// newRuntimeConfig resolves the configured targets into runtime targets
+func newRuntimeConfig(cfg *config.Config) (*runtimeConfig, error) {
+	targets := make([]target, 0, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		label := cfg.TargetLabel(t)
+		retries := metrics.FetchRetriesTotal.WithLabelValues(label)
+		rt, err := newTarget(cfg, t, metrics.FetchObserver{Target: label}, func(attempt int, err error) {
+			retries.Inc()
+			log.Printf("Retrying %s (retry %d): %v", t.URL, attempt, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		targets = append(targets, rt)
+	}
+
+	return &runtimeConfig{
+		cfg:     cfg,
+		targets: targets,
+		sem:     make(chan struct{}, cfg.Concurrency),
+	}, nil
+}
+
+// newTarget builds a runtime target of cfg with an HTTP client for the target's settings and the source of its type
+func newTarget(cfg *config.Config, t config.Target, observer fetch.Observer, onRetry func(attempt int, err error)) (target, error) {
+	src, ok := source.Lookup(t.Type)
+	if !ok {
+		return target{}, fmt.Errorf("unknown type %q", t.Type)
+	}
+
+	client, err := fetch.NewClient(fetch.Options{
+		Timeout: t.Timeout,
+		Headers: t.Headers,
+		Proxy:   t.Proxy,
+		TLS: fetch.TLSOptions{
+			CAFile:             t.TLS.CAFile,
+			ServerName:         t.TLS.ServerName,
+			InsecureSkipVerify: t.TLS.InsecureSkipVerify,
+			PinSHA256:          t.TLS.PinSHA256,
+		},
+		Retry: fetch.RetryOptions{
+			MaxRetries:     max(t.Retry.MaxRetries, 0),
+			InitialBackoff: t.Retry.InitialBackoff,
+			MaxBackoff:     t.Retry.MaxBackoff,
+		},
+		OnRetry:  onRetry,
+		Observer: observer,
+	})
+	if err != nil {
+		return target{}, err
+	}
+
+	return target{
+		Target:  t,
+		label:   cfg.TargetLabel(t),
+		client:  client,
+		source:  src,
+		privacy: cfg.Privacy,
+	}, nil
+}
+
+// targetLabels returns the set of configured target labels
+func (rt *runtimeConfig) targetLabels() map[string]bool {
+	labels := make(map[string]bool, len(rt.targets))
+	for _, t := range rt.targets {
+		labels[t.label] = true
+	}
+	return labels
+}
+
+// configuredTargets returns the labels of the current targets
+func (e *exporter) configuredTargets() []string {
+	rt := e.current()
+	labels := make([]string, 0, len(rt.targets))
+	for _, t := range rt.targets {
+		labels = append(labels, t.label)
+	}
+	return labels
+}
+
+// current returns the active configuration
+func (e *exporter) current() *runtimeConfig {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rt
+}
+
+// reload re-reads and validates the configuration, then atomically swaps the
+// target list and wakes the refresh loop, which reschedules the targets and
+// drops the metrics of targets that are no longer configured. Metrics of
+// unchanged targets are kept until their next refresh replaces them.
+// On error the previous configuration stays active.
+func (e *exporter) reload() error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	cfg, err := config.Load(e.configFile)
+	if err != nil {
+		metrics.ConfigLastReloadSuccessful.Set(0)
+		return err
+	}
+	for _, warning := range cfg.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+
+	prev := e.current().cfg
+	if cfg.ListenAddress != prev.ListenAddress || cfg.MetricsPath != prev.MetricsPath {
+		log.Printf("Warning: listen_address and metrics_path changes require a restart")
+	}
+
+	rt, err := newRuntimeConfig(cfg)
+	if err != nil {
+		metrics.ConfigLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	e.mu.Lock()
+	e.rt = rt
+	e.mu.Unlock()
+
+	e.logs.SetEnabled(cfg.Privacy.Enabled)
+	e.store.SetGracePeriod(cfg.StaleGracePeriod)
+	e.store.SetUsageWindows(cfg.UsageRateWindows)
+	e.store.SetPrivacyFingerprint(cfg.Privacy.Fingerprint())
+
+	metrics.ConfigLastReloadSuccessful.Set(1)
+	metrics.ConfigLastReloadSuccessTimestampSeconds.SetToCurrentTime()
+	log.Printf("Configuration reloaded: %d target(s)", len(rt.targets))
+
+	// Wake the refresh loop so added and changed targets are fetched right away
+	select {
+	case e.reloaded <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// reloadHandler reloads the configuration on POST /-/reload
+func (e *exporter) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.reload(); err != nil {
+		log.Printf("Configuration reload failed: %v", err)
+		msg := fmt.Sprintf("failed to reload config: %v", err)
+		if e.current().cfg.Privacy.Enabled {
+			msg = redact.Text(msg)
+		}
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
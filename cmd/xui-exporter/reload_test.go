@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/methol/xui-exporter/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	reloadConfig   = "targets:\n  - name: a\n    url: https://example.com/sub/sid-a\n"
+	reloadedConfig = "targets:\n  - name: a\n    url: https://example.com/sub/sid-a\n  - name: b\n    url: https://example.com/sub/sid-b\n"
+	invalidConfig  = "targets:\n  - url: ftp://example.com/sub/sid-a\n"
+)
+
+// rewriteConfig replaces the config file at path with content
+func rewriteConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	e, path := newTestExporter(t, reloadConfig)
+	prev := e.current()
+	metrics.ConfigLastReloadSuccessful.Set(1)
+
+	// An invalid config keeps the previous targets
+	rewriteConfig(t, path, invalidConfig)
+	if err := e.reload(); err == nil {
+		t.Fatal("Expected reload of an invalid config to fail, got nil")
+	}
+	if e.current() != prev {
+		t.Error("Expected the previous configuration to stay active")
+	}
+	if v := testutil.ToFloat64(metrics.ConfigLastReloadSuccessful); v != 0 {
+		t.Errorf("Expected xui_exporter_config_last_reload_successful 0, got %v", v)
+	}
+
+	rewriteConfig(t, path, reloadedConfig)
+	if err := e.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if targets := e.configuredTargets(); len(targets) != 2 {
+		t.Errorf("Expected the reloaded targets, got %v", targets)
+	}
+	if v := testutil.ToFloat64(metrics.ConfigLastReloadSuccessful); v != 1 {
+		t.Errorf("Expected xui_exporter_config_last_reload_successful 1, got %v", v)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	e, path := newTestExporter(t, reloadConfig)
+
+	reload := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.reloadHandler(rec, httptest.NewRequest(method, "/-/reload", nil))
+		return rec
+	}
+
+	rec := reload(http.MethodGet)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for GET, got %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("Expected Allow: POST, got %q", allow)
+	}
+
+	rewriteConfig(t, path, invalidConfig)
+	if rec := reload(http.MethodPost); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 for an invalid config, got %d", rec.Code)
+	}
+
+	rewriteConfig(t, path, reloadedConfig)
+	if rec := reload(http.MethodPost); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if targets := e.configuredTargets(); len(targets) != 2 {
+		t.Errorf("Expected the reloaded targets, got %v", targets)
+	}
+}
@@ -0,0 +1,364 @@
+// Package api serves the current subscription state as JSON.
+// The JSON field names form the v1 API and are versioned independently of
+// the metric names: they must not change within v1.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/store"
+	"github.com/prometheus/common/model"
+)
+
+// Version is the API version, part of the URL path and of every response
+const Version = "v1"
+
+// Subscription is the v1 representation of a subscription
+type Subscription struct {
+	SID    string            `json:"sid"`
+	Target string            `json:"target"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Up is true when the last refresh succeeded; Stale when the values are
+	// carried over from an earlier refresh
+	Up    bool `json:"up"`
+	Stale bool `json:"stale"`
+
+	// LastError is the reason of the last failed refresh (empty while up)
+	LastError string `json:"last_error,omitempty"`
+
+	// Traffic, Expiry, Usage and Counters are absent when no values are known
+	Traffic  *Traffic  `json:"traffic,omitempty"`
+	Expiry   *Expiry   `json:"expiry,omitempty"`
+	Usage    *Usage    `json:"usage,omitempty"`
+	Counters *Counters `json:"counters,omitempty"`
+
+	Freshness Freshness `json:"freshness"`
+}
+
+// Traffic holds the raw and derived traffic values. Fields that are
+// undefined for unlimited quota are omitted.
+type Traffic struct {
+	DownloadBytes    int64    `json:"download_bytes"`
+	UploadBytes      int64    `json:"upload_bytes"`
+	UsedBytes        int64    `json:"used_bytes"`
+	Unlimited        bool     `json:"unlimited"`
+	QuotaBytes       *int64   `json:"quota_bytes,omitempty"`
+	RemainingBytes   *int64   `json:"remaining_bytes,omitempty"`
+	UsedRatio        *float64 `json:"used_ratio,omitempty"`
+	RemainingRatio   *float64 `json:"remaining_ratio,omitempty"`
+	DailyBudgetBytes *float64 `json:"daily_budget_bytes,omitempty"`
+}
+
+// Expiry holds the expiration values. Fields that are undefined for
+// subscriptions that never expire are omitted.
+type Expiry struct {
+	NoExpiry           bool       `json:"no_expiry"`
+	Expired            bool       `json:"expired"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	SecondsUntilExpire *int64     `json:"seconds_until_expire,omitempty"`
+	DaysUntilExpire    *float64   `json:"days_until_expire,omitempty"`
+}
+
+// Usage holds the usage rates and the projected quota exhaustion
+type Usage struct {
+	Rates                   []UsageRate `json:"rates"`
+	ProjectedExhaustionAt   *time.Time  `json:"projected_exhaustion_at,omitempty"`
+	WillExhaustBeforeExpiry bool        `json:"will_exhaust_before_expiry"`
+}
+
+// UsageRate is the average consumption over a window
+type UsageRate struct {
+	Window         string  `json:"window"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// Counters holds the traffic counters accumulated across resets
+type Counters struct {
+	DownloadBytesTotal int64 `json:"download_bytes_total"`
+	UploadBytesTotal   int64 `json:"upload_bytes_total"`
+	Resets             int64 `json:"resets"`
+}
+
+// Freshness tells when the values were fetched
+type Freshness struct {
+	LastRefreshAt          *time.Time `json:"last_refresh_at,omitempty"`
+	LastSuccessAt          *time.Time `json:"last_success_at,omitempty"`
+	DataAgeSeconds         *float64   `json:"data_age_seconds,omitempty"`
+	RefreshDurationSeconds float64    `json:"refresh_duration_seconds"`
+}
+
+// listResponse is the body of the list endpoint
+type listResponse struct {
+	APIVersion    string         `json:"api_version"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// itemResponse is the body of the single subscription endpoint
+type itemResponse struct {
+	APIVersion   string       `json:"api_version"`
+	Subscription Subscription `json:"subscription"`
+}
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	APIVersion string `json:"api_version"`
+	Error      string `json:"error"`
+}
+
+// Handler serves the subscription API from a store
+type Handler struct {
+	store *store.Store
+	mux   *http.ServeMux
+}
+
+// NewHandler creates a Handler serving
+//
+//	GET /api/v1/subscriptions        all subscriptions, with optional filters
+//	GET /api/v1/subscriptions/{sid}  a single subscription
+//
+// The list accepts the filters target, sid, up, stale, expired and
+// label.<name>=<value>; all given filters must match.
+func NewHandler(st *store.Store) *Handler {
+	h := &Handler{store: st, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /api/"+Version+"/subscriptions", h.list)
+	h.mux.HandleFunc("GET /api/"+Version+"/subscriptions/{sid}", h.get)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// list serves all subscriptions matching the query filters
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	match, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscriptions := make([]Subscription, 0)
+	for _, s := range h.subscriptions() {
+		if match(s) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{APIVersion: Version, Subscriptions: subscriptions})
+}
+
+// get serves the subscription with the SID of the path
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	sid := r.PathValue("sid")
+
+	var found []Subscription
+	for _, s := range h.subscriptions() {
+		if s.SID == sid {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		writeError(w, http.StatusNotFound, "subscription not found")
+	case 1:
+		writeJSON(w, http.StatusOK, itemResponse{APIVersion: Version, Subscription: found[0]})
+	default:
+		// Panel clients may share a SID; the list endpoint returns all of them
+		writeError(w, http.StatusConflict, "sid matches several subscriptions, use /api/"+Version+"/subscriptions?sid=")
+	}
+}
+
+// subscriptions converts the current snapshot, sorted by target then SID
+func (h *Handler) subscriptions() []Subscription {
+	reasons := make(map[string]string)
+	for _, t := range h.store.GetTargets() {
+		if !t.Up {
+			reasons[t.Target] = t.Reason
+		}
+	}
+
+	now := time.Now()
+	snapshot := h.store.GetSnapshot()
+	subscriptions := make([]Subscription, 0, len(snapshot))
+	for _, m := range snapshot {
+		subscriptions = append(subscriptions, newSubscription(m, reasons[m.Target], now))
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.SID != b.SID {
+			return a.SID < b.SID
+		}
+		return a.Labels["email"] < b.Labels["email"]
+	})
+	return subscriptions
+}
+
+// newSubscription converts a snapshot entry. targetReason is the failure
+// reason of its target, if the target is down.
+func newSubscription(m compute.SubscriptionMetrics, targetReason string, now time.Time) Subscription {
+	s := Subscription{
+		SID:    m.SID,
+		Target: m.Target,
+		Labels: m.AllLabels(),
+		Up:     m.Up,
+		Stale:  m.Stale,
+		Freshness: Freshness{
+			LastRefreshAt:          timestamp(m.LastRefreshTimestampSeconds),
+			LastSuccessAt:          timestamp(m.LastSuccessTimestampSeconds),
+			RefreshDurationSeconds: m.RefreshDurationSeconds,
+		},
+	}
+
+	if !m.Up {
+		s.LastError = targetReason
+		if s.LastError == "" && !m.Stale {
+			// The target fetched fine, so the subscription itself failed validation
+			s.LastError = store.ReasonValidation
+		}
+	}
+
+	if m.LastSuccessTimestampSeconds > 0 {
+		age := float64(now.Unix()) - m.LastSuccessTimestampSeconds
+		s.Freshness.DataAgeSeconds = &age
+	}
+
+	// Failed entries without carried-over values have nothing else to show
+	if !m.Up && !m.Stale {
+		return s
+	}
+
+	s.Traffic = &Traffic{
+		DownloadBytes: m.DownloadBytes,
+		UploadBytes:   m.UploadBytes,
+		UsedBytes:     m.UsedBytes,
+		Unlimited:     m.UnlimitedQuota,
+	}
+	if !m.UnlimitedQuota {
+		s.Traffic.QuotaBytes = &m.QuotaBytes
+		s.Traffic.RemainingBytes = &m.RemainingBytes
+		s.Traffic.UsedRatio = &m.UsedRatio
+		s.Traffic.RemainingRatio = &m.RemainingRatio
+		if !m.NoExpiry {
+			s.Traffic.DailyBudgetBytes = &m.DailyBudgetBytes
+		}
+	}
+
+	s.Expiry = &Expiry{
+		NoExpiry: m.NoExpiry,
+		Expired:  m.Expired == 1,
+	}
+	if !m.NoExpiry {
+		s.Expiry.ExpiresAt = timestamp(float64(m.ExpireTimestampSeconds))
+		s.Expiry.SecondsUntilExpire = &m.SecondsUntilExpire
+		s.Expiry.DaysUntilExpire = &m.DaysUntilExpire
+	}
+
+	s.Usage = &Usage{
+		Rates:                   make([]UsageRate, 0, len(m.UsageRates)),
+		ProjectedExhaustionAt:   timestamp(m.ProjectedExhaustionTimestampSeconds),
+		WillExhaustBeforeExpiry: m.WillExhaustBeforeExpiry == 1,
+	}
+	for _, rate := range m.UsageRates {
+		s.Usage.Rates = append(s.Usage.Rates, UsageRate{
+			Window:         model.Duration(rate.Window).String(),
+			BytesPerSecond: rate.BytesPerSecond,
+		})
+	}
+
+	s.Counters = &Counters{
+		DownloadBytesTotal: m.DownloadBytesTotal(),
+		UploadBytesTotal:   m.UploadBytesTotal(),
+		Resets:             m.Resets,
+	}
+
+	return s
+}
+
+// parseFilter builds a predicate from the list query parameters
+func parseFilter(query map[string][]string) (func(Subscription) bool, error) {
+	var preds []func(Subscription) bool
+
+	for key, values := range query {
+		value := values[0]
+		switch {
+		case key == "target":
+			preds = append(preds, func(s Subscription) bool { return s.Target == value })
+		case key == "sid":
+			preds = append(preds, func(s Subscription) bool { return s.SID == value })
+		case key == "up" || key == "stale" || key == "expired":
+			want, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a boolean", key)
+			}
+			field := key
+			preds = append(preds, func(s Subscription) bool { return boolField(s, field) == want })
+		case strings.HasPrefix(key, "label."):
+			name := strings.TrimPrefix(key, "label.")
+			preds = append(preds, func(s Subscription) bool {
+				v, ok := s.Labels[name]
+				return ok && v == value
+			})
+		default:
+			return nil, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+
+	return func(s Subscription) bool {
+		for _, pred := range preds {
+			if !pred(s) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// boolField returns the value of a boolean filter field
+func boolField(s Subscription, field string) bool {
+	switch field {
+	case "up":
+		return s.Up
+	case "stale":
+		return s.Stale
+	default:
+		return s.Expiry != nil && s.Expiry.Expired
+	}
+}
+
+// timestamp converts Unix seconds to a time, nil for 0
+func timestamp(seconds float64) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	t := time.Unix(int64(seconds), 0).UTC()
+	return &t
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{APIVersion: Version, Error: msg})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+func newTestStore() *store.Store {
+	now := float64(time.Now().Unix())
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {
+			SID: "sid1", Target: "alice", Up: true,
+			DownloadBytes: 100, UploadBytes: 50, UsedBytes: 150, QuotaBytes: 1000, RemainingBytes: 850,
+			ExpireTimestampSeconds: 1769184000, LastSuccessTimestampSeconds: now,
+		},
+		"sid2": {
+			SID: "sid2", Target: "bob", Up: true, UnlimitedQuota: true, NoExpiry: true,
+			DownloadBytes: 10, UsedBytes: 10, LastSuccessTimestampSeconds: now,
+		},
+		"sid3": {SID: "sid3", Target: "carol", Up: false},
+	}, []store.TargetStatus{
+		{Target: "alice", Up: true},
+		{Target: "bob", Up: true},
+		{Target: "carol", Up: false, Reason: store.ReasonTimeout},
+	})
+	return st
+}
+
+func get(t *testing.T, h http.Handler, url string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode %s: %v (body: %s)", url, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestList(t *testing.T) {
+	h := NewHandler(newTestStore())
+
+	var resp listResponse
+	if code := get(t, h, "/api/v1/subscriptions", &resp); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+
+	if resp.APIVersion != "v1" || len(resp.Subscriptions) != 3 {
+		t.Fatalf("Expected 3 subscriptions in v1, got %+v", resp)
+	}
+
+	// Sorted by target
+	alice, bob, carol := resp.Subscriptions[0], resp.Subscriptions[1], resp.Subscriptions[2]
+	if alice.SID != "sid1" || bob.SID != "sid2" || carol.SID != "sid3" {
+		t.Errorf("Unexpected order: %s, %s, %s", alice.SID, bob.SID, carol.SID)
+	}
+
+	if alice.Traffic == nil || alice.Traffic.RemainingBytes == nil || *alice.Traffic.RemainingBytes != 850 {
+		t.Errorf("Expected remaining bytes 850, got %+v", alice.Traffic)
+	}
+
+	if bob.Traffic == nil || !bob.Traffic.Unlimited || bob.Traffic.QuotaBytes != nil {
+		t.Errorf("Expected unlimited traffic without quota, got %+v", bob.Traffic)
+	}
+
+	if carol.LastError != store.ReasonTimeout || carol.Traffic != nil {
+		t.Errorf("Expected last error 'timeout' and no traffic, got %+v", carol)
+	}
+}
+
+func TestList_Filters(t *testing.T) {
+	h := NewHandler(newTestStore())
+
+	var resp listResponse
+	get(t, h, "/api/v1/subscriptions?up=true&target=bob", &resp)
+	if len(resp.Subscriptions) != 1 || resp.Subscriptions[0].SID != "sid2" {
+		t.Errorf("Expected only sid2, got %+v", resp.Subscriptions)
+	}
+
+	if code := get(t, h, "/api/v1/subscriptions?up=maybe", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid boolean, got %d", code)
+	}
+
+	if code := get(t, h, "/api/v1/subscriptions?color=red", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown filter, got %d", code)
+	}
+}
+
+func TestGet(t *testing.T) {
+	h := NewHandler(newTestStore())
+
+	var resp itemResponse
+	if code := get(t, h, "/api/v1/subscriptions/sid1", &resp); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if resp.Subscription.SID != "sid1" || resp.Subscription.Freshness.LastSuccessAt == nil {
+		t.Errorf("Unexpected subscription: %+v", resp.Subscription)
+	}
+
+	var errResp errorResponse
+	if code := get(t, h, "/api/v1/subscriptions/unknown", &errResp); code != http.StatusNotFound || errResp.Error == "" {
+		t.Errorf("Expected status 404 with an error, got %d (%+v)", code, errResp)
+	}
+}
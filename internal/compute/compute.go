@@ -1,6 +1,8 @@
 package compute
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/methol/xui-exporter/internal/parse"
@@ -11,9 +13,31 @@ type SubscriptionMetrics struct {
 	// Metadata
 	SID string
 
+	// Target is the label of the target the subscription was fetched from
+	Target string
+
+	// Labels are extra labels attached to every series of the subscription
+	Labels map[string]string
+
+	// TargetLabels are the static labels configured for the target, attached
+	// to every series of the subscription next to Labels
+	TargetLabels map[string]string
+
+	// Info is the metadata exported by the info metric
+	Info Info
+
 	// Health
 	Up bool
 
+	// Stale is true when the values were not produced by the latest
+	// refresh (e.g. restored from the state file)
+	Stale bool
+
+	// UnlimitedQuota and NoExpiry are set for a quota or expire of 0; the
+	// derived metrics that are undefined for them are left at 0 and not exported
+	UnlimitedQuota bool
+	NoExpiry       bool
+
 	// Raw metrics (from x-ui)
 	DownloadBytes         int64
 	UploadBytes           int64
@@ -30,9 +54,61 @@ type SubscriptionMetrics struct {
 	Expired                   int64 // 0 or 1
 	DailyBudgetBytes          float64
 
+	// Usage rate metrics, derived from the used bytes history (see ApplyUsage)
+	UsageRates                          []UsageRate
+	ProjectedExhaustionTimestampSeconds float64 // 0 if no projection
+	WillExhaustBeforeExpiry             int64   // 0 or 1
+
+	// Traffic reset tracking for the monotonic counters (see ApplyCounters)
+	Resets              int64
+	DownloadOffsetBytes int64
+	UploadOffsetBytes   int64
+
 	// Troubleshooting metrics
 	LastRefreshTimestampSeconds float64
 	RefreshDurationSeconds      float64
+
+	// LastSuccessTimestampSeconds is when the raw values were fetched (0 if never)
+	LastSuccessTimestampSeconds float64
+}
+
+// Info is the descriptive metadata of a subscription. Only the fields
+// allowed by the configuration are filled in (see NewInfo).
+type Info struct {
+	SubURL       string `json:"sub_url,omitempty"`
+	Remark       string `json:"remark,omitempty"`
+	Email        string `json:"email,omitempty"`
+	SourceTarget string `json:"source_target,omitempty"`
+}
+
+// Info field names, as used by the configuration allow-list and the info metric labels
+const (
+	InfoSubURL       = "sub_url"
+	InfoRemark       = "remark"
+	InfoEmail        = "email"
+	InfoSourceTarget = "source_target"
+)
+
+// InfoFields are the valid Info field names
+var InfoFields = []string{InfoSubURL, InfoRemark, InfoEmail, InfoSourceTarget}
+
+// NewInfo returns the metadata of parsed restricted to the allowed field
+// names. sourceTarget is the label of the target the subscription came from.
+func NewInfo(parsed parse.ParsedSubscription, sourceTarget string, allowed []string) Info {
+	var info Info
+	for _, name := range allowed {
+		switch name {
+		case InfoSubURL:
+			info.SubURL = parsed.SubURL
+		case InfoRemark:
+			info.Remark = parsed.Remark
+		case InfoEmail:
+			info.Email = parsed.Email
+		case InfoSourceTarget:
+			info.SourceTarget = sourceTarget
+		}
+	}
+	return info
 }
 
 // Compute calculates all derived metrics from parsed subscription data
@@ -43,8 +119,15 @@ func Compute(now time.Time, parsed parse.ParsedSubscription, refreshStart time.T
 	// Calculate used bytes
 	usedBytes := parsed.DownloadByte + parsed.UploadByte
 
+	// A quota or expire of 0 means unlimited/never (only accepted when allowed)
+	unlimitedQuota := parsed.TotalByte == 0
+	noExpiry := parsed.Expire == 0
+
 	// Calculate remaining bytes (can be negative if over quota)
-	remainingBytes := parsed.TotalByte - usedBytes
+	var remainingBytes int64
+	if !unlimitedQuota {
+		remainingBytes = parsed.TotalByte - usedBytes
+	}
 
 	// Calculate ratios (use float64 for precision)
 	var usedRatio, remainingRatio float64
@@ -53,15 +136,17 @@ func Compute(now time.Time, parsed parse.ParsedSubscription, refreshStart time.T
 		remainingRatio = float64(remainingBytes) / float64(parsed.TotalByte)
 	}
 
-	// Calculate seconds until expire
-	secondsUntilExpire := parsed.Expire - nowUnix
-
-	// Calculate days until expire
-	daysUntilExpire := float64(secondsUntilExpire) / 86400.0
+	// Calculate seconds and days until expire
+	var secondsUntilExpire int64
+	var daysUntilExpire float64
+	if !noExpiry {
+		secondsUntilExpire = parsed.Expire - nowUnix
+		daysUntilExpire = float64(secondsUntilExpire) / 86400.0
+	}
 
 	// Calculate expired flag
 	var expired int64
-	if secondsUntilExpire <= 0 {
+	if !noExpiry && secondsUntilExpire <= 0 {
 		expired = 1
 	}
 
@@ -70,14 +155,17 @@ func Compute(now time.Time, parsed parse.ParsedSubscription, refreshStart time.T
 	if daysUntilExpire > 0 && remainingBytes > 0 {
 		dailyBudgetBytes = float64(remainingBytes) / daysUntilExpire
 	}
-	// If expired or no remaining bytes, daily budget is 0
+	// If expired, unlimited, never expiring or no remaining bytes, daily budget is 0
 
 	// Calculate troubleshooting metrics
 	refreshDuration := time.Since(refreshStart).Seconds()
 
 	return SubscriptionMetrics{
 		SID:                    parsed.SID,
+		Labels:                 parsed.Labels,
 		Up:                     true,
+		UnlimitedQuota:         unlimitedQuota,
+		NoExpiry:               noExpiry,
 		DownloadBytes:          parsed.DownloadByte,
 		UploadBytes:            parsed.UploadByte,
 		QuotaBytes:             parsed.TotalByte,
@@ -92,7 +180,49 @@ func Compute(now time.Time, parsed parse.ParsedSubscription, refreshStart time.T
 		DailyBudgetBytes:       dailyBudgetBytes,
 		LastRefreshTimestampSeconds: float64(now.Unix()),
 		RefreshDurationSeconds:      refreshDuration,
+		LastSuccessTimestampSeconds: float64(now.Unix()),
+	}
+}
+
+// Key returns the snapshot key of the subscription: its SID, followed by its
+// extra labels when present, since panel clients may share a SID
+func (m SubscriptionMetrics) Key() string {
+	if len(m.Labels) == 0 {
+		return m.SID
+	}
+
+	names := make([]string, 0, len(m.Labels))
+	for name := range m.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(m.SID)
+	for _, name := range names {
+		b.WriteString("\xff")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(m.Labels[name])
+	}
+	return b.String()
+}
+
+// AllLabels returns the extra labels of the subscription merged with the
+// static labels of its target
+func (m SubscriptionMetrics) AllLabels() map[string]string {
+	if len(m.TargetLabels) == 0 {
+		return m.Labels
+	}
+
+	labels := make(map[string]string, len(m.Labels)+len(m.TargetLabels))
+	for name, value := range m.TargetLabels {
+		labels[name] = value
+	}
+	for name, value := range m.Labels {
+		labels[name] = value
 	}
+	return labels
 }
 
 // NewFailedMetrics creates a SubscriptionMetrics with up=0 for a failed subscription
@@ -154,6 +154,38 @@ func TestCompute_ZeroQuotaDailyBudget(t *testing.T) {
 	}
 }
 
+func TestCompute_UnlimitedAndNoExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	parsed := parse.ParsedSubscription{
+		SID:          "test123",
+		DownloadByte: 1000,
+		UploadByte:   500,
+		TotalByte:    0,
+		Expire:       0,
+	}
+
+	result := Compute(now, parsed, now)
+
+	if !result.UnlimitedQuota || !result.NoExpiry {
+		t.Errorf("Expected UnlimitedQuota and NoExpiry, got %v and %v", result.UnlimitedQuota, result.NoExpiry)
+	}
+
+	if result.UsedBytes != 1500 {
+		t.Errorf("Expected UsedBytes 1500, got %d", result.UsedBytes)
+	}
+
+	if result.RemainingBytes != 0 || result.UsedRatio != 0 || result.DailyBudgetBytes != 0 {
+		t.Errorf("Expected undefined derivations to be 0, got remaining=%d ratio=%f budget=%f",
+			result.RemainingBytes, result.UsedRatio, result.DailyBudgetBytes)
+	}
+
+	if result.Expired != 0 || result.SecondsUntilExpire != 0 {
+		t.Errorf("Expected a never-expiring subscription not to be expired, got expired=%d seconds=%d",
+			result.Expired, result.SecondsUntilExpire)
+	}
+}
+
 func TestNewFailedMetrics(t *testing.T) {
 	now := time.Now()
 	refreshStart := now.Add(-3 * time.Second)
@@ -176,3 +208,39 @@ func TestNewFailedMetrics(t *testing.T) {
 		t.Errorf("Expected positive RefreshDurationSeconds, got %f", result.RefreshDurationSeconds)
 	}
 }
+
+func TestAllLabels(t *testing.T) {
+	m := SubscriptionMetrics{
+		SID:          "sid1",
+		Labels:       map[string]string{"email": "a@example.com"},
+		TargetLabels: map[string]string{"owner": "alice"},
+	}
+
+	labels := m.AllLabels()
+	if len(labels) != 2 || labels["email"] != "a@example.com" || labels["owner"] != "alice" {
+		t.Errorf("Expected email and owner labels, got %v", labels)
+	}
+
+	if key := m.Key(); key != "sid1\xffemail=a@example.com" {
+		t.Errorf("Expected static labels not to be part of the key, got %q", key)
+	}
+}
+
+func TestNewInfo(t *testing.T) {
+	parsed := parse.ParsedSubscription{
+		SID:    "sid1",
+		SubURL: "https://example.com/sub/sid1",
+		Remark: "main",
+		Email:  "alice@example.com",
+	}
+
+	info := NewInfo(parsed, "alice", []string{InfoRemark, InfoSourceTarget})
+	want := Info{Remark: "main", SourceTarget: "alice"}
+	if info != want {
+		t.Errorf("Expected %+v, got %+v", want, info)
+	}
+
+	if info := NewInfo(parsed, "alice", nil); info != (Info{}) {
+		t.Errorf("Expected no metadata without an allow-list, got %+v", info)
+	}
+}
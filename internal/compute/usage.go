@@ -0,0 +1,119 @@
+package compute
+
+import "time"
+
+// UsageSample is a point in the used bytes history of a subscription
+type UsageSample struct {
+	TimestampSeconds float64 `json:"timestamp_seconds"`
+	UsedBytes        int64   `json:"used_bytes"`
+}
+
+// UsageRate is the average consumption of a subscription over a window
+type UsageRate struct {
+	Window         time.Duration
+	BytesPerSecond float64
+}
+
+// ApplyUsage sets the usage rate and projection fields of m from its used
+// bytes history (oldest first, ending with m's own sample).
+// A window's rate is only set once the history covers at least half of it.
+// The projection uses the longest window with a rate; windows must be sorted
+// in ascending order.
+func ApplyUsage(m *SubscriptionMetrics, history []UsageSample, windows []time.Duration) {
+	m.UsageRates = nil
+	m.ProjectedExhaustionTimestampSeconds = 0
+	m.WillExhaustBeforeExpiry = 0
+
+	if len(history) == 0 {
+		return
+	}
+	last := history[len(history)-1]
+
+	for _, window := range windows {
+		cutoff := last.TimestampSeconds - window.Seconds()
+
+		// Oldest sample inside the window
+		first := last
+		for _, sample := range history {
+			if sample.TimestampSeconds >= cutoff {
+				first = sample
+				break
+			}
+		}
+
+		span := last.TimestampSeconds - first.TimestampSeconds
+		if span <= 0 || span < window.Seconds()/2 {
+			continue
+		}
+
+		m.UsageRates = append(m.UsageRates, UsageRate{
+			Window:         window,
+			BytesPerSecond: float64(last.UsedBytes-first.UsedBytes) / span,
+		})
+	}
+
+	// Nothing to exhaust
+	if m.UnlimitedQuota {
+		return
+	}
+
+	// Already over quota: exhausted now
+	if m.RemainingBytes <= 0 {
+		m.ProjectedExhaustionTimestampSeconds = last.TimestampSeconds
+		if m.Expired == 0 {
+			m.WillExhaustBeforeExpiry = 1
+		}
+		return
+	}
+
+	if len(m.UsageRates) == 0 {
+		return
+	}
+
+	rate := m.UsageRates[len(m.UsageRates)-1].BytesPerSecond
+	if rate <= 0 {
+		return
+	}
+
+	m.ProjectedExhaustionTimestampSeconds = last.TimestampSeconds + float64(m.RemainingBytes)/rate
+	if m.NoExpiry || m.ProjectedExhaustionTimestampSeconds < float64(m.ExpireTimestampSeconds) {
+		m.WillExhaustBeforeExpiry = 1
+	}
+}
+
+// ApplyCounters carries the monotonic counter state of prev (the previous
+// values of the same subscription, nil if unknown) over to m. A decrease of
+// the download or upload bytes is a traffic reset: the previous value is added
+// to that direction's offset, so offset + current value never decreases.
+func ApplyCounters(m *SubscriptionMetrics, prev *SubscriptionMetrics) {
+	if prev == nil {
+		return
+	}
+
+	m.Resets = prev.Resets
+	m.DownloadOffsetBytes = prev.DownloadOffsetBytes
+	m.UploadOffsetBytes = prev.UploadOffsetBytes
+
+	reset := false
+	if m.DownloadBytes < prev.DownloadBytes {
+		m.DownloadOffsetBytes += prev.DownloadBytes
+		reset = true
+	}
+	if m.UploadBytes < prev.UploadBytes {
+		m.UploadOffsetBytes += prev.UploadBytes
+		reset = true
+	}
+	if reset {
+		m.Resets++
+	}
+}
+
+// DownloadBytesTotal is the download bytes accumulated across traffic resets
+func (m SubscriptionMetrics) DownloadBytesTotal() int64 {
+	return m.DownloadOffsetBytes + m.DownloadBytes
+}
+
+// UploadBytesTotal is the upload bytes accumulated across traffic resets
+func (m SubscriptionMetrics) UploadBytesTotal() int64 {
+	return m.UploadOffsetBytes + m.UploadBytes
+}
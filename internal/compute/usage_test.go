@@ -0,0 +1,87 @@
+package compute
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyUsage_RatesAndProjection(t *testing.T) {
+	// 3600 bytes per hour = 1 B/s over the last 2 hours
+	history := []UsageSample{
+		{TimestampSeconds: 0, UsedBytes: 0},
+		{TimestampSeconds: 3600, UsedBytes: 3600},
+		{TimestampSeconds: 7200, UsedBytes: 7200},
+	}
+	m := SubscriptionMetrics{
+		UsedBytes:              7200,
+		RemainingBytes:         10000,
+		ExpireTimestampSeconds: 20000,
+	}
+
+	ApplyUsage(&m, history, []time.Duration{time.Hour, 24 * time.Hour})
+
+	// The 24h window is covered by less than half, so only 1h has a rate
+	if len(m.UsageRates) != 1 || m.UsageRates[0].Window != time.Hour {
+		t.Fatalf("Expected a single 1h rate, got %+v", m.UsageRates)
+	}
+	if m.UsageRates[0].BytesPerSecond != 1 {
+		t.Errorf("Expected 1 B/s, got %f", m.UsageRates[0].BytesPerSecond)
+	}
+
+	if m.ProjectedExhaustionTimestampSeconds != 17200 {
+		t.Errorf("Expected exhaustion at 17200, got %f", m.ProjectedExhaustionTimestampSeconds)
+	}
+	if m.WillExhaustBeforeExpiry != 1 {
+		t.Errorf("Expected will_exhaust_before_expiry 1, got %d", m.WillExhaustBeforeExpiry)
+	}
+
+	// Expiry before the projected exhaustion
+	m.ExpireTimestampSeconds = 10000
+	ApplyUsage(&m, history, []time.Duration{time.Hour})
+	if m.WillExhaustBeforeExpiry != 0 {
+		t.Errorf("Expected will_exhaust_before_expiry 0, got %d", m.WillExhaustBeforeExpiry)
+	}
+}
+
+func TestApplyUsage_NotEnoughHistory(t *testing.T) {
+	m := SubscriptionMetrics{RemainingBytes: 100}
+	ApplyUsage(&m, []UsageSample{{TimestampSeconds: 100, UsedBytes: 5}}, []time.Duration{time.Hour})
+
+	if len(m.UsageRates) != 0 || m.ProjectedExhaustionTimestampSeconds != 0 {
+		t.Errorf("Expected no rates or projection, got %+v", m)
+	}
+}
+
+func TestApplyUsage_OverQuota(t *testing.T) {
+	m := SubscriptionMetrics{RemainingBytes: -1}
+	ApplyUsage(&m, []UsageSample{{TimestampSeconds: 100, UsedBytes: 5}}, []time.Duration{time.Hour})
+
+	if m.ProjectedExhaustionTimestampSeconds != 100 || m.WillExhaustBeforeExpiry != 1 {
+		t.Errorf("Expected exhaustion now, got %+v", m)
+	}
+}
+
+func TestApplyCounters(t *testing.T) {
+	prev := SubscriptionMetrics{DownloadBytes: 500, UploadBytes: 100, DownloadOffsetBytes: 1000, Resets: 2}
+
+	// Download reset, upload kept growing
+	m := SubscriptionMetrics{DownloadBytes: 20, UploadBytes: 150}
+	ApplyCounters(&m, &prev)
+
+	if m.Resets != 3 {
+		t.Errorf("Expected 3 resets, got %d", m.Resets)
+	}
+	if m.DownloadBytesTotal() != 1520 {
+		t.Errorf("Expected download total 1520, got %d", m.DownloadBytesTotal())
+	}
+	if m.UploadBytesTotal() != 150 {
+		t.Errorf("Expected upload total 150, got %d", m.UploadBytesTotal())
+	}
+
+	// No reset
+	next := SubscriptionMetrics{DownloadBytes: 30, UploadBytes: 150}
+	ApplyCounters(&next, &m)
+	if next.Resets != 3 || next.DownloadBytesTotal() != 1530 {
+		t.Errorf("Expected 3 resets and download total 1530, got %d and %d", next.Resets, next.DownloadBytesTotal())
+	}
+}
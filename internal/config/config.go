@@ -1,11 +1,599 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/labelnames"
+	"github.com/methol/xui-exporter/internal/redact"
+	"github.com/methol/xui-exporter/internal/source"
+	yaml "go.yaml.in/yaml/v2"
+)
+
+// Default runtime settings, used when the config file does not set them
+const (
+	DefaultListenAddress   = ":9100"
+	DefaultMetricsPath     = "/metrics"
+	DefaultRefreshInterval = 60 * time.Second
+	DefaultConcurrency     = 4
+	DefaultTargetTimeout   = 15 * time.Second
+	DefaultStaleGrace      = 5 * time.Minute
+	DefaultMaxRetries      = 2
 )
 
+// Lower bounds of the refresh interval and target timeout. Durations written
+// without a unit are read as nanoseconds, so these also catch e.g. "timeout: 15".
+const (
+	MinRefreshInterval = time.Second
+	MinTargetTimeout   = 100 * time.Millisecond
+)
+
+// DefaultUsageRateWindows are the windows of the usage rate metrics
+var DefaultUsageRateWindows = []time.Duration{time.Hour, 24 * time.Hour}
+
+// labelNameRE matches valid Prometheus label names
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Config is the exporter configuration.
+// It is loaded from an optional YAML/JSON file, with XUI_EXPORTER_TARGETS merged in.
+type Config struct {
+	ListenAddress   string        `yaml:"listen_address"`
+	MetricsPath     string        `yaml:"metrics_path"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	Concurrency     int           `yaml:"concurrency"`
+	RedactTargets   bool          `yaml:"redact_targets"`
+
+	// Privacy hides SIDs and subscription URLs from labels and logs
+	Privacy PrivacyConfig `yaml:"privacy"`
+
+	// StaleGracePeriod is how long the last successful values of a
+	// subscription keep being exported (marked stale) after the first missed
+	// refresh of its target.
+	// Defaults to 5m; a negative value disables carrying values forward.
+	StaleGracePeriod time.Duration `yaml:"stale_grace_period"`
+
+	// AllowUnlimited accepts subscriptions with a quota of 0 (unlimited)
+	// or an expiry of 0 (never expires) instead of reporting them as failed
+	AllowUnlimited bool `yaml:"allow_unlimited"`
+
+	// InfoLabels is the allow-list of metadata exported as labels of
+	// xui_subscription_info (sub_url, remark, email, source_target).
+	// Empty by default, so sensitive fields are only exported when asked.
+	InfoLabels []string `yaml:"info_labels"`
+
+	// UsageRateWindows are the windows over which usage rates and the
+	// projected quota exhaustion are computed (default 1h and 24h)
+	UsageRateWindows []time.Duration `yaml:"usage_rate_windows"`
+
+	// Proxy is the default outbound proxy URL for all targets
+	// (http, https, socks5 or socks5h). Environment proxies are used when empty.
+	Proxy string `yaml:"proxy"`
+
+	// ProxyFile reads Proxy from a file, for proxy URLs with credentials
+	ProxyFile string `yaml:"proxy_file"`
+
+	// Retry is the default retry policy for all targets
+	Retry RetryConfig `yaml:"retry"`
+
+	// StateFile persists the last snapshot across restarts when set
+	StateFile string `yaml:"state_file"`
+
+	// Targets are the subscription URLs to refresh
+	Targets []Target `yaml:"targets"`
+
+	// Warnings are non-fatal problems found while loading, e.g. secret
+	// files with loose permissions
+	Warnings []string `yaml:"-"`
+}
+
+// Target is a single subscription URL with optional per-target settings
+type Target struct {
+	URL string `yaml:"url"`
+
+	// Type selects the source that fetches and parses the target
+	// (default "subscription", see the source package)
+	Type string `yaml:"type"`
+
+	// Panel holds the login credentials of a panel target
+	Panel PanelConfig `yaml:"panel"`
+
+	// Name replaces the URL in the target label when set
+	Name string `yaml:"name"`
+
+	// Labels are static labels attached to every series of the target and
+	// its subscriptions, e.g. owner, provider, plan or region
+	Labels map[string]string `yaml:"labels"`
+
+	// RefreshInterval overrides the global refresh interval when set
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Timeout bounds a whole refresh attempt for the target (default 15s)
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Headers are extra request headers sent to the target
+	Headers map[string]string `yaml:"headers"`
+
+	// HeaderFiles are extra request headers whose values are read from
+	// files, e.g. an Authorization header, by header name
+	HeaderFiles map[string]string `yaml:"header_files"`
+
+	// Proxy overrides the global proxy when set
+	Proxy string `yaml:"proxy"`
+
+	// ProxyFile reads Proxy from a file
+	ProxyFile string `yaml:"proxy_file"`
+
+	// TLS configures certificate verification for HTTPS targets
+	TLS TLSConfig `yaml:"tls"`
+
+	// Retry overrides the global retry policy when set
+	Retry *RetryConfig `yaml:"retry"`
+
+	// AllowUnlimited overrides the global allow_unlimited setting when set
+	AllowUnlimited *bool `yaml:"allow_unlimited"`
+
+	// InfoLabels overrides the global info_labels allow-list when set
+	InfoLabels []string `yaml:"info_labels"`
+}
+
+// TLSConfig configures TLS for self-signed or IP-addressed panels
+type TLSConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile string `yaml:"ca_file"`
+
+	// ServerName overrides the SNI and verified host name
+	ServerName string `yaml:"server_name"`
+
+	// InsecureSkipVerify disables certificate verification
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+
+	// PinSHA256 is the SHA-256 fingerprint of the leaf certificate; it
+	// replaces chain verification, so self-signed certificates work
+	PinSHA256 string `yaml:"pin_sha256"`
+}
+
+// PanelConfig holds the credentials used to log into a 3x-ui panel
+type PanelConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// TwoFactorToken is the base32 TOTP secret, for panels with 2FA enabled
+	TwoFactorToken string `yaml:"two_factor_token"`
+
+	// PasswordFile and TwoFactorTokenFile read the secrets from files instead
+	PasswordFile       string `yaml:"password_file"`
+	TwoFactorTokenFile string `yaml:"two_factor_token_file"`
+}
+
+// PrivacyConfig configures privacy mode. When enabled, SIDs are replaced by
+// their alias or a keyed hash before they reach the store, target labels are
+// redacted as with redact_targets, sub_url metadata is redacted and URLs are
+// masked in log lines.
+type PrivacyConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// HashKey is the secret key of the SID hash, required when enabled.
+	// Keep it stable: changing it changes every sid label.
+	HashKey string `yaml:"hash_key"`
+
+	// HashKeyFile reads the hash key from a file instead
+	HashKeyFile string `yaml:"hash_key_file"`
+
+	// Aliases map SIDs to the names exported instead of their hash
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// SID returns the value exported for a subscription ID: the SID itself
+// unless privacy mode is enabled, otherwise its alias or keyed hash
+func (p PrivacyConfig) SID(sid string) string {
+	if !p.Enabled {
+		return sid
+	}
+	if alias, ok := p.Aliases[sid]; ok {
+		return alias
+	}
+	return redact.SID(sid, p.HashKey)
+}
+
+// Fingerprint identifies the SIDs produced by these settings without
+// revealing the hash key: empty while privacy mode is disabled (raw SIDs),
+// otherwise a keyed hash of a constant and the aliases. It is stored in the
+// state file, so subscriptions saved under other settings are not restored.
+func (p PrivacyConfig) Fingerprint() string {
+	if !p.Enabled {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.HashKey))
+	mac.Write([]byte("xui-exporter state"))
+	sids := make([]string, 0, len(p.Aliases))
+	for sid := range p.Aliases {
+		sids = append(sids, sid)
+	}
+	slices.Sort(sids)
+	for _, sid := range sids {
+		fmt.Fprintf(mac, "\x00%s\x00%s", sid, p.Aliases[sid])
+	}
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// RetryConfig configures retries of network errors, 5xx and 429 responses
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	// Defaults to 2; a negative value disables retries.
+	MaxRetries int `yaml:"max_retries"`
+
+	// InitialBackoff and MaxBackoff bound the exponential backoff (defaults 500ms and 5s)
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// Load builds the configuration from the file at path (if non-empty) and the
+// environment. Targets from XUI_EXPORTER_TARGETS (or the file named by
+// XUI_EXPORTER_TARGETS_FILE) are appended to the file's targets, skipping
+// URLs the file already declares. Secret files are read on every call, so a
+// reload picks up rotated secrets.
+// Returns error if the file is invalid or no targets are configured.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// YAML is a superset of JSON, so both formats are handled here
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	targets, err := cfg.secretEnv("XUI_EXPORTER_TARGETS")
+	if err != nil {
+		return nil, err
+	}
+	if targets != "" {
+		envTargets, err := parseTargetList("XUI_EXPORTER_TARGETS", targets)
+		if err != nil {
+			return nil, err
+		}
+		cfg.mergeTargets(envTargets)
+	}
+
+	if env := os.Getenv("XUI_EXPORTER_STATE_FILE"); env != "" {
+		cfg.StateFile = env
+	}
+
+	if os.Getenv("XUI_EXPORTER_ALLOW_UNLIMITED") != "" {
+		allowUnlimited, err := ParseAllowUnlimitedFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		cfg.AllowUnlimited = allowUnlimited
+	}
+
+	if os.Getenv("XUI_EXPORTER_PRIVACY") != "" {
+		privacy, err := parseBoolEnv("XUI_EXPORTER_PRIVACY")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Privacy.Enabled = privacy
+	}
+
+	hashKey, err := cfg.secretEnv("XUI_EXPORTER_PRIVACY_HASH_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if hashKey != "" {
+		cfg.Privacy.HashKey = hashKey
+	}
+
+	if os.Getenv("XUI_EXPORTER_REDACT_TARGETS") != "" {
+		redactTargets, err := ParseRedactTargetsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RedactTargets = redactTargets
+	}
+
+	cfg.applyDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// mergeTargets appends plain URLs as targets unless already declared
+func (c *Config) mergeTargets(urls []string) {
+	seen := make(map[string]bool, len(c.Targets))
+	for _, t := range c.Targets {
+		seen[t.URL] = true
+	}
+
+	for _, u := range urls {
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		c.Targets = append(c.Targets, Target{URL: u})
+	}
+}
+
+// applyDefaults fills in unset settings
+func (c *Config) applyDefaults() {
+	if c.ListenAddress == "" {
+		c.ListenAddress = DefaultListenAddress
+	}
+	if c.MetricsPath == "" {
+		c.MetricsPath = DefaultMetricsPath
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.StaleGracePeriod == 0 {
+		c.StaleGracePeriod = DefaultStaleGrace
+	}
+	if c.Retry.MaxRetries == 0 {
+		c.Retry.MaxRetries = DefaultMaxRetries
+	}
+	if len(c.UsageRateWindows) == 0 {
+		c.UsageRateWindows = DefaultUsageRateWindows
+	}
+	for i := range c.Targets {
+		c.applyTargetDefaults(&c.Targets[i])
+	}
+}
+
+// applyTargetDefaults fills unset target settings from the global settings
+func (c *Config) applyTargetDefaults(t *Target) {
+	if t.Type == "" {
+		t.Type = source.TypeSubscription
+	}
+	if t.RefreshInterval == 0 {
+		t.RefreshInterval = c.RefreshInterval
+	}
+	if t.Timeout == 0 {
+		t.Timeout = DefaultTargetTimeout
+	}
+	if t.Proxy == "" {
+		t.Proxy = c.Proxy
+	}
+	if t.Retry == nil {
+		t.Retry = &c.Retry
+	} else {
+		t.Retry.inherit(c.Retry)
+	}
+	if t.AllowUnlimited == nil {
+		t.AllowUnlimited = &c.AllowUnlimited
+	}
+	if t.InfoLabels == nil {
+		t.InfoLabels = c.InfoLabels
+	}
+}
+
+// TargetFor returns the configured target whose URL or name matches,
+// or an ad-hoc target for rawURL with the global settings applied
+func (c *Config) TargetFor(rawURL string) Target {
+	for _, t := range c.Targets {
+		if t.URL == rawURL || (t.Name != "" && t.Name == rawURL) {
+			return t
+		}
+	}
+
+	t := Target{URL: rawURL}
+	c.applyTargetDefaults(&t)
+	return t
+}
+
+// inherit fills unset fields from the global retry policy
+func (r *RetryConfig) inherit(global RetryConfig) {
+	if r.MaxRetries == 0 {
+		r.MaxRetries = global.MaxRetries
+	}
+	if r.InitialBackoff == 0 {
+		r.InitialBackoff = global.InitialBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = global.MaxBackoff
+	}
+}
+
+// Validate checks the configuration for errors
+func (c *Config) Validate() error {
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("no targets configured (set XUI_EXPORTER_TARGETS, XUI_EXPORTER_TARGETS_FILE or targets in the config file)")
+	}
+
+	if !strings.HasPrefix(c.MetricsPath, "/") {
+		return fmt.Errorf("metrics_path must start with '/' (got %q)", c.MetricsPath)
+	}
+
+	if err := validateMin("refresh_interval", c.RefreshInterval, MinRefreshInterval); err != nil {
+		return err
+	}
+
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must be positive (got %d)", c.Concurrency)
+	}
+
+	if err := validateInfoLabels(c.InfoLabels); err != nil {
+		return err
+	}
+
+	if err := c.Privacy.validate(); err != nil {
+		return err
+	}
+
+	for _, window := range c.UsageRateWindows {
+		if window <= 0 {
+			return fmt.Errorf("usage_rate_windows must be positive (got %s)", window)
+		}
+	}
+
+	urls := make(map[string]bool, len(c.Targets))
+	labels := make(map[string]bool, len(c.Targets))
+	for i, t := range c.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("targets[%d]: url must be an absolute http(s) URL", i)
+		}
+
+		if urls[t.URL] {
+			return fmt.Errorf("targets[%d]: duplicate url", i)
+		}
+		urls[t.URL] = true
+
+		label := c.TargetLabel(t)
+		if labels[label] {
+			return fmt.Errorf("targets[%d]: duplicate target name %q", i, label)
+		}
+		labels[label] = true
+
+		if t.Proxy != "" {
+			if _, err := fetch.ParseProxyURL(t.Proxy); err != nil {
+				return fmt.Errorf("targets[%d]: %w", i, err)
+			}
+		}
+
+		if t.TLS.PinSHA256 != "" {
+			if _, err := fetch.ParseFingerprint(t.TLS.PinSHA256); err != nil {
+				return fmt.Errorf("targets[%d]: %w", i, err)
+			}
+		}
+
+		if _, ok := source.Lookup(t.Type); !ok {
+			return fmt.Errorf("targets[%d]: unknown type %q (expected one of %s)", i, t.Type, strings.Join(source.Types(), ", "))
+		}
+
+		if t.Type == source.TypePanel && (t.Panel.Username == "" || t.Panel.Password == "") {
+			return fmt.Errorf("targets[%d]: panel targets require panel.username and panel.password", i)
+		}
+
+		if err := validateInfoLabels(t.InfoLabels); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+
+		if err := validateMin("refresh_interval", t.RefreshInterval, MinRefreshInterval); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+
+		if err := validateMin("timeout", t.Timeout, MinTargetTimeout); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+
+		if err := t.Retry.validate(); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+
+		for name := range t.Labels {
+			if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("targets[%d]: invalid label name %q", i, name)
+			}
+			if slices.Contains(labelnames.Reserved, name) {
+				return fmt.Errorf("targets[%d]: label %q is reserved (reserved: %s)", i, name, strings.Join(labelnames.Reserved, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateMin checks that the duration setting name is at least lower
+func validateMin(name string, d, lower time.Duration) error {
+	if d < lower {
+		return fmt.Errorf("%s must be at least %s (got %s; durations need a unit, e.g. 60s)", name, lower, d)
+	}
+	return nil
+}
+
+// validate checks the backoff bounds, with unset ones at their fetch defaults
+func (r RetryConfig) validate() error {
+	if r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("retry.initial_backoff and retry.max_backoff must not be negative")
+	}
+
+	initialBackoff, maxBackoff := r.InitialBackoff, r.MaxBackoff
+	if initialBackoff == 0 {
+		initialBackoff = fetch.DefaultInitialBackoff
+	}
+	if maxBackoff == 0 {
+		maxBackoff = fetch.DefaultMaxBackoff
+	}
+	if initialBackoff > maxBackoff {
+		return fmt.Errorf("retry.initial_backoff (%s) must not exceed retry.max_backoff (%s)", initialBackoff, maxBackoff)
+	}
+	return nil
+}
+
+// validate checks the hash key and aliases of an enabled privacy mode
+func (p PrivacyConfig) validate() error {
+	if !p.Enabled {
+		return nil
+	}
+
+	if p.HashKey == "" {
+		return fmt.Errorf("privacy.hash_key is required when privacy mode is enabled")
+	}
+
+	aliases := make(map[string]bool, len(p.Aliases))
+	for _, alias := range p.Aliases {
+		if alias == "" {
+			return fmt.Errorf("privacy.aliases: empty alias")
+		}
+		if aliases[alias] {
+			return fmt.Errorf("privacy.aliases: duplicate alias %q", alias)
+		}
+		aliases[alias] = true
+	}
+	return nil
+}
+
+// validateInfoLabels checks an info_labels allow-list against the known metadata fields
+func validateInfoLabels(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(compute.InfoFields, name) {
+			return fmt.Errorf("info_labels: unknown field %q (expected one of %s)", name, strings.Join(compute.InfoFields, ", "))
+		}
+	}
+	return nil
+}
+
+// TargetLabel returns the value of the target label for t: its name if set,
+// otherwise its URL (redacted when RedactTargets or privacy mode is enabled)
+func (c *Config) TargetLabel(t Target) string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if c.RedactTargets || c.Privacy.Enabled {
+		return redact.URL(t.URL)
+	}
+	return t.URL
+}
+
 // ParseTargetsFromEnv parses the XUI_EXPORTER_TARGETS environment variable
 // and returns a list of target URLs.
 // Returns error if the environment variable is empty or contains no valid URLs.
@@ -15,8 +603,13 @@ func ParseTargetsFromEnv() ([]string, error) {
 		return nil, fmt.Errorf("XUI_EXPORTER_TARGETS environment variable is required but not set")
 	}
 
-	// Split by comma and trim whitespace
-	rawTargets := strings.Split(env, ",")
+	return parseTargetList("XUI_EXPORTER_TARGETS", env)
+}
+
+// parseTargetList splits a list of target URLs separated by commas or newlines
+func parseTargetList(name, list string) ([]string, error) {
+	// Split by comma or newline and trim whitespace
+	rawTargets := strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' })
 	var targets []string
 
 	for _, target := range rawTargets {
@@ -27,8 +620,37 @@ func ParseTargetsFromEnv() ([]string, error) {
 	}
 
 	if len(targets) == 0 {
-		return nil, fmt.Errorf("XUI_EXPORTER_TARGETS contains no valid URLs after parsing")
+		return nil, fmt.Errorf("%s contains no valid URLs after parsing", name)
 	}
 
 	return targets, nil
 }
+
+// ParseRedactTargetsFromEnv parses the optional XUI_EXPORTER_REDACT_TARGETS
+// environment variable. When true, target URLs are redacted in the
+// target label of xui_target_* metrics. Defaults to false.
+func ParseRedactTargetsFromEnv() (bool, error) {
+	return parseBoolEnv("XUI_EXPORTER_REDACT_TARGETS")
+}
+
+// ParseAllowUnlimitedFromEnv parses the optional XUI_EXPORTER_ALLOW_UNLIMITED
+// environment variable. When true, subscriptions with unlimited quota or no
+// expiry are accepted. Defaults to false.
+func ParseAllowUnlimitedFromEnv() (bool, error) {
+	return parseBoolEnv("XUI_EXPORTER_ALLOW_UNLIMITED")
+}
+
+// parseBoolEnv parses an optional boolean environment variable (false if unset)
+func parseBoolEnv(name string) (bool, error) {
+	env := os.Getenv(name)
+	if env == "" {
+		return false, nil
+	}
+
+	value, err := strconv.ParseBool(env)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean: %w", name, err)
+	}
+
+	return value, nil
+}
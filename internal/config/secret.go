@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// secretEnv returns the value of the environment variable name, or the
+// contents of the file named by name_FILE (Docker and Kubernetes secrets
+// style). Setting both is an error.
+func (c *Config) secretEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("%s and %s_FILE are mutually exclusive", name, name)
+	}
+	return c.readSecretFile(name+"_FILE", path)
+}
+
+// secretField resolves a config file setting that may also be given as a
+// file: the contents of the file at path if set, otherwise value.
+// Setting both is an error.
+func (c *Config) secretField(name, value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("%s and %s_file are mutually exclusive", name, name)
+	}
+	return c.readSecretFile(name+"_file", path)
+}
+
+// readSecretFile reads a secret from the file at path, without trailing
+// newlines. A file accessible by other users, or writable by its group,
+// adds a warning.
+func (c *Config) readSecretFile(setting, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", setting, err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o027 != 0 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%s: secret file %s is accessible by other users (mode %04o), restrict it to the owner", setting, path, info.Mode().Perm()))
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets fills in the secrets given as files in the config file
+func (c *Config) resolveSecrets() error {
+	var err error
+	if c.Privacy.HashKey, err = c.secretField("privacy.hash_key", c.Privacy.HashKey, c.Privacy.HashKeyFile); err != nil {
+		return err
+	}
+	if c.Proxy, err = c.secretField("proxy", c.Proxy, c.ProxyFile); err != nil {
+		return err
+	}
+
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.Panel.Password, err = c.secretField("panel.password", t.Panel.Password, t.Panel.PasswordFile); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if t.Panel.TwoFactorToken, err = c.secretField("panel.two_factor_token", t.Panel.TwoFactorToken, t.Panel.TwoFactorTokenFile); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if t.Proxy, err = c.secretField("proxy", t.Proxy, t.ProxyFile); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if err := c.resolveHeaderFiles(t); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveHeaderFiles adds the headers of t whose values are given as files.
+// A header set both ways is an error; header names are case-insensitive.
+func (c *Config) resolveHeaderFiles(t *Target) error {
+	if len(t.HeaderFiles) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(t.Headers))
+	for name := range t.Headers {
+		set[http.CanonicalHeaderKey(name)] = true
+	}
+
+	if t.Headers == nil {
+		t.Headers = make(map[string]string, len(t.HeaderFiles))
+	}
+	for name, path := range t.HeaderFiles {
+		if set[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("headers.%s and header_files.%s are mutually exclusive", name, name)
+		}
+		value, err := c.readSecretFile("header_files."+name, path)
+		if err != nil {
+			return err
+		}
+		t.Headers[name] = value
+	}
+
+	return nil
+}
@@ -2,9 +2,12 @@ package fetch
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 )
 
@@ -13,25 +16,237 @@ const (
 	DefaultTimeout = 10 * time.Second
 )
 
-// GetHTML fetches HTML content from the given URL with a timeout.
-// Returns the HTML bytes on success, or an error if the request fails or returns non-200 status.
-func GetHTML(ctx context.Context, url string) ([]byte, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: DefaultTimeout,
+// StatusError is returned when the server answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+
+	// RetryAfter is the delay requested by a Retry-After header (0 if absent)
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP status %d (expected 200)", e.StatusCode)
+}
+
+// IsTimeout reports whether err was caused by a deadline or client timeout
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var timeoutErr interface{ Timeout() bool }
+	return errors.As(err, &timeoutErr) && timeoutErr.Timeout()
+}
+
+// Response holds the body and headers of a successful fetch
+type Response struct {
+	Body   []byte
+	Header http.Header
+
+	// CertNotAfter is the expiry of the server's leaf certificate (zero for plain HTTP)
+	CertNotAfter time.Time
+}
+
+// Options configures a Client
+type Options struct {
+	// Timeout is the HTTP client timeout (default DefaultTimeout)
+	Timeout time.Duration
+
+	// Headers are extra request headers; they override the default Accept header
+	Headers map[string]string
+
+	// Proxy is an outbound proxy URL (http, https, socks5 or socks5h, with
+	// optional user:password). Environment proxies are used when empty.
+	Proxy string
+
+	// TLS configures certificate verification for HTTPS targets
+	TLS TLSOptions
+
+	// Retry configures retries of failed attempts (no retries by default)
+	Retry RetryOptions
+
+	// OnRetry is called before each retry with the attempt number (starting at 1)
+	// and the error that caused it
+	OnRetry func(attempt int, err error)
+
+	// Observer receives per-attempt timings and response sizes (optional)
+	Observer Observer
+}
+
+// Client fetches subscription pages with per-target settings
+type Client struct {
+	httpClient *http.Client
+	headers    map[string]string
+	retry      RetryOptions
+	onRetry    func(attempt int, err error)
+	observer   Observer
+}
+
+// NewClient creates a Client from the given options
+// Returns error if the proxy URL or TLS options are invalid.
+func NewClient(opts Options) (*Client, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxyURL, err := ParseProxyURL(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := newTLSConfig(opts.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		headers:  opts.Headers,
+		retry:    opts.Retry.withDefaults(),
+		onRetry:  opts.OnRetry,
+		observer: opts.Observer,
+	}, nil
+}
+
+// CloseIdleConnections closes the idle keep-alive connections of the client.
+// Call it when done with a short-lived client, e.g. one built for a probe.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// ParseProxyURL parses and validates an outbound proxy URL
+func ParseProxyURL(rawURL string) (*neturl.URL, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		// Report only the cause; the URL may contain credentials
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected http, https, socks5 or socks5h)", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL has no host")
+	}
+
+	return u, nil
+}
+
+// request describes an HTTP request; it is rebuilt for every attempt
+type request struct {
+	method string
+	url    string
+	accept string
+	form   neturl.Values
+
+	// headers are per-request defaults; the client's headers override them
+	headers map[string]string
+}
+
+// Get fetches the given URL and returns the body together with the response headers.
+// Failed attempts are retried according to the client's RetryOptions.
+// Returns an error if the request fails or returns non-200 status.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	return c.do(ctx, c.httpClient, request{
+		method: http.MethodGet,
+		url:    url,
+		accept: "text/html",
+	})
+}
+
+// GetWithHeaders is like Get but sends the given headers, e.g. a User-Agent
+// some providers require. The client's configured headers override them.
+func (c *Client) GetWithHeaders(ctx context.Context, url string, headers map[string]string) (*Response, error) {
+	return c.do(ctx, c.httpClient, request{
+		method:  http.MethodGet,
+		url:     url,
+		accept:  "*/*",
+		headers: headers,
+	})
+}
+
+// do performs r with hc, retrying failed attempts according to the client's RetryOptions
+func (c *Client) do(ctx context.Context, hc *http.Client, r request) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, hc, r)
+		if err == nil {
+			return resp, nil
+		}
+
+		if attempt >= c.retry.MaxRetries || !isRetryable(ctx, err) {
+			return nil, err
+		}
+
+		wait := c.retry.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			wait = statusErr.RetryAfter
+		}
+
+		// Give up if the wait would overrun the caller's deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+
+		if c.onRetry != nil {
+			c.onRetry(attempt+1, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt performs a single request
+func (c *Client) attempt(ctx context.Context, hc *http.Client, r request) (*Response, error) {
+	var body io.Reader
+	if r.form != nil {
+		body = strings.NewReader(r.form.Encode())
 	}
 
 	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Set Accept header to request HTML content
-	req.Header.Set("Accept", "text/html")
+	if r.form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Accept", r.accept)
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
 
-	// Execute request
-	resp, err := client.Do(req)
+	// Execute request, tracing its phases
+	req, done := c.trace(req)
+	defer done()
+	resp, err := hc.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
@@ -39,14 +254,49 @@ func GetHTML(ctx context.Context, url string) ([]byte, error) {
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP status %d (expected 200)", resp.StatusCode)
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	return body, nil
+	if c.observer != nil {
+		c.observer.ObserveResponseSize(len(respBody))
+	}
+
+	result := &Response{
+		Body:   respBody,
+		Header: resp.Header,
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.CertNotAfter = resp.TLS.PeerCertificates[0].NotAfter
+	}
+
+	return result, nil
+}
+
+// Get fetches the given URL with the default timeout and returns the body together with the response headers.
+// Returns an error if the request fails or returns non-200 status.
+func Get(ctx context.Context, url string) (*Response, error) {
+	client, err := NewClient(Options{})
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(ctx, url)
+}
+
+// GetHTML fetches HTML content from the given URL with a timeout.
+// Returns the HTML bytes on success, or an error if the request fails or returns non-200 status.
+func GetHTML(ctx context.Context, url string) ([]byte, error) {
+	resp, err := Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
 }
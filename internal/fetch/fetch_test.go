@@ -0,0 +1,192 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	client, err := NewClient(opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client
+}
+
+func TestGet_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "clash" {
+			t.Errorf("Expected User-Agent 'clash', got '%s'", r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Subscription-Userinfo", "upload=1; download=2; total=3; expire=4")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, Options{Headers: map[string]string{"User-Agent": "clash"}})
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if string(resp.Body) != "<html></html>" {
+		t.Errorf("Unexpected body: %s", resp.Body)
+	}
+
+	if resp.Header.Get("Subscription-Userinfo") == "" {
+		t.Error("Expected Subscription-Userinfo header to be surfaced")
+	}
+}
+
+func TestGet_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var retries []int
+	client := newTestClient(t, Options{
+		Retry:   RetryOptions{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+		OnRetry: func(attempt int, err error) { retries = append(retries, attempt) },
+	})
+
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected success after retries, got error: %v", err)
+	}
+
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+
+	if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+		t.Errorf("Expected OnRetry for attempts [1 2], got %v", retries)
+	}
+}
+
+func TestGet_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, Options{Retry: RetryOptions{MaxRetries: 3, InitialBackoff: time.Millisecond}})
+	_, err := client.Get(context.Background(), server.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected StatusError 404, got %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 attempt, got %d", calls.Load())
+	}
+}
+
+func TestGet_RetryAfterBoundedByDeadline(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client := newTestClient(t, Options{Retry: RetryOptions{MaxRetries: 3}})
+	start := time.Now()
+	_, err := client.Get(ctx, server.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.RetryAfter != 30*time.Second {
+		t.Fatalf("Expected StatusError with RetryAfter 30s, got %v", err)
+	}
+
+	if calls.Load() != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected an immediate give-up, got %d attempt(s) in %v", calls.Load(), time.Since(start))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"-1":                            0,
+		"garbage":                       0,
+		"Wed, 01 Jan 2025 00:00:10 GMT": 10 * time.Second,
+	}
+
+	for value, expected := range tests {
+		if got := parseRetryAfter(value, now); got != expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, got %v", value, expected, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := RetryOptions{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := r.backoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("backoff(%d) = %v, expected within [%v, %v]", attempt, d, max/2, max)
+		}
+	}
+}
+
+func TestBackoff_Saturates(t *testing.T) {
+	// An initial backoff above the cap must not overflow on late attempts
+	r := RetryOptions{InitialBackoff: time.Hour, MaxBackoff: time.Second}
+
+	for _, attempt := range []int{0, 1, 40, 63, 100} {
+		if d := r.backoff(attempt); d < r.MaxBackoff/2 || d > r.MaxBackoff {
+			t.Errorf("backoff(%d) = %v, expected within [%v, %v]", attempt, d, r.MaxBackoff/2, r.MaxBackoff)
+		}
+	}
+}
+
+func TestClient_CloseIdleConnections(t *testing.T) {
+	var closed atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := newTestClient(t, Options{})
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	client.CloseIdleConnections()
+	deadline := time.Now().Add(time.Second)
+	for closed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if closed.Load() != 1 {
+		t.Errorf("Expected the idle connection to be closed, got %d closed", closed.Load())
+	}
+}
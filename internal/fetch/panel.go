@@ -0,0 +1,126 @@
+package fetch
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Paths of the 3x-ui panel endpoints, relative to the panel base URL
+const (
+	panelLoginPath        = "/login"
+	panelInboundsListPath = "/panel/api/inbounds/list"
+)
+
+// PanelCredentials are the login credentials of a 3x-ui panel
+type PanelCredentials struct {
+	Username string
+	Password string
+
+	// TwoFactorToken is the panel's TOTP secret (base32); when set, a
+	// one-time code is generated for every login
+	TwoFactorToken string
+}
+
+// LoginError is returned when the panel rejects the credentials
+type LoginError struct {
+	Msg string
+}
+
+func (e *LoginError) Error() string {
+	if e.Msg == "" {
+		return "panel login failed"
+	}
+	return fmt.Sprintf("panel login failed: %s", e.Msg)
+}
+
+// panelLoginResponse is the JSON envelope returned by the panel login endpoint
+type panelLoginResponse struct {
+	Success bool   `json:"success"`
+	Msg     string `json:"msg"`
+}
+
+// GetPanelInbounds logs into the 3x-ui panel at baseURL (including any web
+// base path) with a fresh cookie session and returns the raw JSON of the
+// inbounds list API. Parse it with parse.ParsePanelInbounds.
+func (c *Client) GetPanelInbounds(ctx context.Context, baseURL string, creds PanelCredentials) (*Response, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+
+	// Share the transport and timeout, but keep the session cookie per call
+	hc := *c.httpClient
+	hc.Jar = jar
+
+	base := strings.TrimRight(baseURL, "/")
+
+	form := neturl.Values{
+		"username": {creds.Username},
+		"password": {creds.Password},
+	}
+	if creds.TwoFactorToken != "" {
+		code, err := TOTPCode(creds.TwoFactorToken, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		form.Set("twoFactorCode", code)
+	}
+
+	loginResp, err := c.do(ctx, &hc, request{
+		method: http.MethodPost,
+		url:    base + panelLoginPath,
+		accept: "application/json",
+		form:   form,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	var login panelLoginResponse
+	if err := json.Unmarshal(loginResp.Body, &login); err != nil || !login.Success {
+		return nil, &LoginError{Msg: login.Msg}
+	}
+
+	resp, err := c.do(ctx, &hc, request{
+		method: http.MethodGet,
+		url:    base + panelInboundsListPath,
+		accept: "application/json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list inbounds: %w", err)
+	}
+
+	return resp, nil
+}
+
+// TOTPCode generates the RFC 6238 one-time code (SHA-1, 6 digits, 30s step)
+// for a base32 secret at time t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(normalized, "="))
+	if err != nil {
+		return "", fmt.Errorf("two-factor token is not valid base32: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
@@ -0,0 +1,103 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newPanelTestServer(t *testing.T, code string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/base/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST login, got %s", r.Method)
+		}
+		if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" || r.FormValue("twoFactorCode") != code {
+			w.Write([]byte(`{"success": false, "msg": "wrong credentials"}`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "3x-ui", Value: "session", Path: "/"})
+		w.Write([]byte(`{"success": true, "msg": "Login successful"}`))
+	})
+	mux.HandleFunc("/base/panel/api/inbounds/list", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("3x-ui"); err != nil || cookie.Value != "session" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"success": true, "obj": []}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetPanelInbounds(t *testing.T) {
+	server := newPanelTestServer(t, "")
+
+	client := newTestClient(t, Options{})
+	resp, err := client.GetPanelInbounds(context.Background(), server.URL+"/base/", PanelCredentials{
+		Username: "admin",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if string(resp.Body) != `{"success": true, "obj": []}` {
+		t.Errorf("Unexpected body: %s", resp.Body)
+	}
+}
+
+func TestGetPanelInbounds_WrongPassword(t *testing.T) {
+	server := newPanelTestServer(t, "")
+
+	client := newTestClient(t, Options{})
+	_, err := client.GetPanelInbounds(context.Background(), server.URL+"/base", PanelCredentials{
+		Username: "admin",
+		Password: "wrong",
+	})
+
+	var loginErr *LoginError
+	if !errors.As(err, &loginErr) || loginErr.Msg != "wrong credentials" {
+		t.Fatalf("Expected LoginError, got %v", err)
+	}
+}
+
+func TestGetPanelInbounds_TwoFactor(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newPanelTestServer(t, code)
+
+	client := newTestClient(t, Options{})
+	_, err = client.GetPanelInbounds(context.Background(), server.URL+"/base", PanelCredentials{
+		Username:       "admin",
+		Password:       "secret",
+		TwoFactorToken: secret,
+	})
+	if err != nil {
+		t.Fatalf("Expected success with two-factor code, got error: %v", err)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test vector (SHA-1 secret "12345678901234567890"), last 6 digits
+	code, err := TOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if code != "287082" {
+		t.Errorf("Expected code '287082', got '%s'", code)
+	}
+
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("Expected error for invalid secret, got nil")
+	}
+}
@@ -0,0 +1,183 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// socks5StandIn is a minimal SOCKS5 server (RFC 1928/1929) supporting
+// username/password auth and CONNECT, used to test proxied fetches
+type socks5StandIn struct {
+	listener net.Listener
+	user     string
+	pass     string
+	connects atomic.Int32
+}
+
+func newSOCKS5StandIn(t *testing.T, user, pass string) *socks5StandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &socks5StandIn{listener: ln, user: user, pass: pass}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *socks5StandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *socks5StandIn) handle(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: VER NMETHODS METHODS...; require username/password (0x02)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	conn.Write([]byte{0x05, 0x02})
+
+	// Auth: VER ULEN UNAME PLEN PASSWD
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	user := make([]byte, header[1])
+	io.ReadFull(conn, user)
+	plen := make([]byte, 1)
+	io.ReadFull(conn, plen)
+	pass := make([]byte, plen[0])
+	io.ReadFull(conn, pass)
+	if string(user) != s.user || string(pass) != s.pass {
+		conn.Write([]byte{0x01, 0x01})
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 0x01 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 0x01:
+		addr := make([]byte, 4)
+		io.ReadFull(conn, addr)
+		host = net.IP(addr).String()
+	case 0x03:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		name := make([]byte, n[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	portBytes := make([]byte, 2)
+	io.ReadFull(conn, portBytes)
+	port := binary.BigEndian.Uint16(portBytes)
+
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	s.connects.Add(1)
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func TestGet_SOCKS5Proxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks"))
+	}))
+	defer server.Close()
+
+	proxy := newSOCKS5StandIn(t, "alice", "secret")
+
+	client := newTestClient(t, Options{Proxy: "socks5://alice:secret@" + proxy.listener.Addr().String()})
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected success through SOCKS5 proxy, got error: %v", err)
+	}
+
+	if string(resp.Body) != "via socks" {
+		t.Errorf("Unexpected body: %s", resp.Body)
+	}
+
+	if proxy.connects.Load() != 1 {
+		t.Errorf("Expected 1 proxied connection, got %d", proxy.connects.Load())
+	}
+
+	// Wrong credentials must fail
+	client = newTestClient(t, Options{Proxy: "socks5://alice:wrong@" + proxy.listener.Addr().String()})
+	if _, err := client.Get(context.Background(), server.URL); err == nil {
+		t.Error("Expected error with wrong proxy credentials, got nil")
+	}
+}
+
+func TestGet_HTTPProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL
+		if r.URL.Host != "panel.invalid" {
+			t.Errorf("Expected proxied host 'panel.invalid', got '%s'", r.URL.Host)
+		}
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("bob:secret"))
+		if r.Header.Get("Proxy-Authorization") != expected {
+			t.Errorf("Expected Proxy-Authorization '%s', got '%s'", expected, r.Header.Get("Proxy-Authorization"))
+		}
+		proxied.Add(1)
+		w.Write([]byte("via http proxy"))
+	}))
+	defer proxy.Close()
+
+	proxyURL := "http://bob:secret@" + proxy.Listener.Addr().String()
+	client := newTestClient(t, Options{Proxy: proxyURL})
+	resp, err := client.Get(context.Background(), "http://panel.invalid/sub/sid1")
+	if err != nil {
+		t.Fatalf("Expected success through HTTP proxy, got error: %v", err)
+	}
+
+	if string(resp.Body) != "via http proxy" || proxied.Load() != 1 {
+		t.Errorf("Expected one proxied request, got body '%s' and %d request(s)", resp.Body, proxied.Load())
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	for _, valid := range []string{"http://proxy:8080", "https://proxy:443", "socks5://u:p@127.0.0.1:1080", "socks5h://proxy:1080"} {
+		if _, err := ParseProxyURL(valid); err != nil {
+			t.Errorf("ParseProxyURL(%q): unexpected error: %v", valid, err)
+		}
+	}
+
+	for _, invalid := range []string{"ftp://proxy:21", "proxy:8080", "socks5://"} {
+		if _, err := ParseProxyURL(invalid); err == nil {
+			t.Errorf("ParseProxyURL(%q): expected error, got nil", invalid)
+		}
+	}
+}
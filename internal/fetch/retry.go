@@ -0,0 +1,133 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultInitialBackoff is the default delay before the first retry
+	DefaultInitialBackoff = 500 * time.Millisecond
+
+	// DefaultMaxBackoff is the default upper bound of a single retry delay
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// RetryOptions configures retries of failed attempts.
+// Network errors, 5xx and 429 responses are retried with exponential backoff
+// and jitter; a Retry-After header replaces the computed delay. Certificate
+// and protocol errors are permanent and not retried. Retries stop early when
+// the next delay would overrun the context deadline, so an attempt that runs
+// into the client timeout is not retried when the deadline is no later than
+// that timeout (as for exporter targets, whose timeout bounds the whole refresh).
+type RetryOptions struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry (default DefaultInitialBackoff)
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponential delay (default DefaultMaxBackoff)
+	MaxBackoff time.Duration
+}
+
+// withDefaults fills in unset backoff durations
+func (r RetryOptions) withDefaults() RetryOptions {
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = DefaultInitialBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = DefaultMaxBackoff
+	}
+	return r
+}
+
+// backoff returns the delay before retry number attempt+1:
+// InitialBackoff * 2^attempt capped at MaxBackoff, with the upper half jittered.
+// The doubling stops at the cap, so it cannot overflow whatever the settings.
+func (r RetryOptions) backoff(attempt int) time.Duration {
+	d := r.InitialBackoff
+	for range attempt {
+		if d > r.MaxBackoff/2 {
+			d = r.MaxBackoff
+			break
+		}
+		d *= 2
+	}
+	d = min(d, r.MaxBackoff)
+
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// isRetryable reports whether a failed attempt should be retried
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	if isPermanent(err) {
+		return false
+	}
+
+	// Transport-level failures (connection refused, reset, per-attempt timeout)
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isPermanent reports whether a transport error would fail the same way on
+// every attempt: the certificate does not verify or match the pin, or the
+// server speaks plain HTTP on an https URL
+func isPermanent(err error) bool {
+	var (
+		verifyErr     *tls.CertificateVerificationError
+		pinErr        *PinError
+		unknownErr    x509.UnknownAuthorityError
+		hostnameErr   x509.HostnameError
+		invalidErr    x509.CertificateInvalidError
+		constraintErr x509.ConstraintViolationError
+	)
+	switch {
+	case errors.As(err, &verifyErr), errors.As(err, &pinErr),
+		errors.As(err, &unknownErr), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr), errors.As(err, &constraintErr):
+		return true
+	}
+
+	// net/http reports this without a typed error
+	return strings.Contains(err.Error(), "server gave HTTP response to HTTPS client")
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// Returns 0 if the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,202 @@
+package fetch
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTLSTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGet_TLSUntrustedByDefault(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	client := newTestClient(t, Options{})
+	if _, err := client.Get(context.Background(), server.URL); err == nil {
+		t.Fatal("Expected error for self-signed certificate, got nil")
+	}
+}
+
+func TestGet_TLSCAFileAndServerName(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The httptest certificate is valid for example.com
+	client := newTestClient(t, Options{TLS: TLSOptions{CAFile: caFile, ServerName: "example.com"}})
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected success with custom CA, got error: %v", err)
+	}
+
+	if !resp.CertNotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("Expected CertNotAfter %v, got %v", server.Certificate().NotAfter, resp.CertNotAfter)
+	}
+
+	client = newTestClient(t, Options{TLS: TLSOptions{CAFile: caFile, ServerName: "other.invalid"}})
+	if _, err := client.Get(context.Background(), server.URL); err == nil {
+		t.Error("Expected error for mismatched server name, got nil")
+	}
+}
+
+func TestGet_TLSPin(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Colon-separated form as printed by openssl
+	var colon []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colon = append(colon, fingerprint[i:i+2])
+	}
+
+	client := newTestClient(t, Options{TLS: TLSOptions{PinSHA256: strings.Join(colon, ":")}})
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected success with matching pin, got error: %v", err)
+	}
+
+	client = newTestClient(t, Options{TLS: TLSOptions{PinSHA256: strings.Repeat("00", 32)}})
+	_, err := client.Get(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("Expected error with mismatched pin, got nil")
+	}
+
+	if notAfter, ok := FailedCertNotAfter(err); !ok || !notAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("Expected the pin error to carry NotAfter %v, got %v (ok=%v)", server.Certificate().NotAfter, notAfter, ok)
+	}
+}
+
+func TestGet_TLSInsecureSkipVerify(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	client := newTestClient(t, Options{TLS: TLSOptions{InsecureSkipVerify: true}})
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected success with verification disabled, got error: %v", err)
+	}
+}
+
+func TestNewClient_InvalidTLS(t *testing.T) {
+	if _, err := NewClient(Options{TLS: TLSOptions{PinSHA256: "abc"}}); err == nil {
+		t.Error("Expected error for short pin, got nil")
+	}
+
+	if _, err := NewClient(Options{TLS: TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}}); err == nil {
+		t.Error("Expected error for missing CA file, got nil")
+	}
+}
+
+func TestGet_TLSExpiredCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             notAfter.Add(-30 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, Options{TLS: TLSOptions{CAFile: caFile}})
+	_, err = client.Get(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("Expected error for expired certificate, got nil")
+	}
+
+	got, ok := FailedCertNotAfter(err)
+	if !ok || !got.Equal(notAfter) {
+		t.Errorf("Expected NotAfter %v of the expired certificate, got %v (ok=%v)", notAfter, got, ok)
+	}
+}
+
+func TestGet_DoesNotRetryCertificateErrors(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	retry := RetryOptions{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	for name, opts := range map[string]TLSOptions{
+		"untrusted": {},
+		"pin":       {PinSHA256: strings.Repeat("00", 32)},
+	} {
+		retries := 0
+		client := newTestClient(t, Options{
+			TLS:     opts,
+			Retry:   retry,
+			OnRetry: func(attempt int, err error) { retries++ },
+		})
+		if _, err := client.Get(context.Background(), server.URL); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+		if retries != 0 {
+			t.Errorf("%s: expected no retries, got %d", name, retries)
+		}
+	}
+}
+
+func TestGet_DoesNotRetryHTTPResponseToHTTPSClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	retries := 0
+	client := newTestClient(t, Options{
+		Retry:   RetryOptions{MaxRetries: 3, InitialBackoff: time.Millisecond},
+		OnRetry: func(attempt int, err error) { retries++ },
+	})
+	if _, err := client.Get(context.Background(), strings.Replace(server.URL, "http://", "https://", 1)); err == nil {
+		t.Fatal("Expected error for plain HTTP server, got nil")
+	}
+	if retries != 0 {
+		t.Errorf("Expected no retries, got %d", retries)
+	}
+}
@@ -0,0 +1,83 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases reported to an Observer
+const (
+	PhaseDNS     = "dns"
+	PhaseConnect = "connect"
+	PhaseTLS     = "tls"
+	PhaseTTFB    = "ttfb"
+	PhaseTotal   = "total"
+)
+
+// Observer receives measurements of every request attempt made by a Client.
+// Phases that do not happen (e.g. DNS for IP targets, or everything but
+// ttfb and total on a reused connection) are not reported.
+type Observer interface {
+	// ObservePhase reports the duration of a phase (one of the Phase* constants);
+	// ttfb and total are measured from the start of the attempt
+	ObservePhase(phase string, d time.Duration)
+
+	// ObserveResponseSize reports the body size of a successful response
+	ObserveResponseSize(bytes int)
+}
+
+// trace attaches an httptrace.ClientTrace reporting to the client's Observer.
+// The returned function reports the total duration and must be called once
+// the attempt is complete.
+func (c *Client) trace(req *http.Request) (*http.Request, func()) {
+	if c.observer == nil {
+		return req, func() {}
+	}
+
+	start := time.Now()
+
+	// Callbacks may run concurrently, e.g. when dialing several addresses
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart time.Time
+	since := func(t *time.Time, phase string) {
+		mu.Lock()
+		begin := *t
+		mu.Unlock()
+		if !begin.IsZero() {
+			c.observer.ObservePhase(phase, time.Since(begin))
+		}
+	}
+	mark := func(t *time.Time) {
+		mu.Lock()
+		*t = time.Now()
+		mu.Unlock()
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { since(&dnsStart, PhaseDNS) },
+		ConnectStart: func(network, addr string) { mark(&connectStart) },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				since(&connectStart, PhaseConnect)
+			}
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				since(&tlsStart, PhaseTLS)
+			}
+		},
+		GotFirstResponseByte: func() {
+			c.observer.ObservePhase(PhaseTTFB, time.Since(start))
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return req, func() {
+		c.observer.ObservePhase(PhaseTotal, time.Since(start))
+	}
+}
@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	phases map[string]int
+	sizes  []int
+}
+
+func (o *recordingObserver) ObservePhase(phase string, d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.phases == nil {
+		o.phases = make(map[string]int)
+	}
+	o.phases[phase]++
+}
+
+func (o *recordingObserver) ObserveResponseSize(bytes int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sizes = append(o.sizes, bytes)
+}
+
+func TestObserver_Phases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	client := newTestClient(t, Options{
+		TLS:      TLSOptions{InsecureSkipVerify: true},
+		Observer: observer,
+	})
+
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	for _, phase := range []string{PhaseConnect, PhaseTLS, PhaseTTFB, PhaseTotal} {
+		if observer.phases[phase] != 1 {
+			t.Errorf("Expected phase %s to be observed once, got %d", phase, observer.phases[phase])
+		}
+	}
+
+	// The target is an IP address, so there is no DNS lookup
+	if observer.phases[PhaseDNS] != 0 {
+		t.Errorf("Expected no dns phase, got %d", observer.phases[PhaseDNS])
+	}
+
+	if len(observer.sizes) != 1 || observer.sizes[0] != 5 {
+		t.Errorf("Expected response size [5], got %v", observer.sizes)
+	}
+}
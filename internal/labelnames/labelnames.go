@@ -0,0 +1,30 @@
+// Package labelnames lists the label names set by the exporter itself. It
+// has no dependencies, so the configuration can check static target labels
+// against it without importing the metrics package.
+package labelnames
+
+// Identifying labels of the subscription and target series, and the labels
+// the collector adds to some of them
+const (
+	SID    = "sid"
+	Target = "target"
+	Reason = "reason"
+	Window = "window"
+)
+
+// Labels of panel subscriptions (see parse.ParsePanelInbounds)
+const (
+	Inbound  = "inbound"
+	Email    = "email"
+	Protocol = "protocol"
+)
+
+// Labels of the info metric beyond the panel labels (see compute.InfoFields)
+const (
+	SubURL       = "sub_url"
+	Remark       = "remark"
+	SourceTarget = "source_target"
+)
+
+// Reserved are the label names static target labels may not use
+var Reserved = []string{SID, Target, Reason, Window, Inbound, Email, Protocol, SubURL, Remark, SourceTarget}
@@ -1,8 +1,14 @@
 package metrics
 
 import (
+	"slices"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/labelnames"
 	"github.com/methol/xui-exporter/internal/store"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 )
 
 // Collector implements prometheus.Collector interface
@@ -11,264 +17,312 @@ type Collector struct {
 	store *store.Store
 
 	// Metric descriptors
-	up                         *prometheus.Desc
-	downloadBytes              *prometheus.Desc
-	uploadBytes                *prometheus.Desc
-	quotaBytes                 *prometheus.Desc
-	expireTimestampSeconds     *prometheus.Desc
-	usedBytes                  *prometheus.Desc
-	remainingBytes             *prometheus.Desc
-	usedRatio                  *prometheus.Desc
-	remainingRatio             *prometheus.Desc
-	secondsUntilExpire         *prometheus.Desc
-	daysUntilExpire            *prometheus.Desc
-	expired                    *prometheus.Desc
-	dailyBudgetBytes           *prometheus.Desc
-	lastRefreshTimestampSeconds *prometheus.Desc
-	refreshDurationSeconds     *prometheus.Desc
+	up                          *dynamicDesc
+	info                        *dynamicDesc
+	stale                       *dynamicDesc
+	dataAgeSeconds              *dynamicDesc
+	downloadBytes               *dynamicDesc
+	uploadBytes                 *dynamicDesc
+	quotaBytes                  *dynamicDesc
+	expireTimestampSeconds      *dynamicDesc
+	unlimitedQuota              *dynamicDesc
+	noExpiry                    *dynamicDesc
+	usedBytes                   *dynamicDesc
+	remainingBytes              *dynamicDesc
+	usedRatio                   *dynamicDesc
+	remainingRatio              *dynamicDesc
+	secondsUntilExpire          *dynamicDesc
+	daysUntilExpire             *dynamicDesc
+	expired                     *dynamicDesc
+	dailyBudgetBytes            *dynamicDesc
+	usageRate                   *dynamicDesc
+	projectedExhaustion         *dynamicDesc
+	willExhaustBeforeExpiry     *dynamicDesc
+	resetsTotal                 *dynamicDesc
+	downloadBytesTotal          *dynamicDesc
+	uploadBytesTotal            *dynamicDesc
+	usedBytesTotal              *dynamicDesc
+	lastRefreshTimestampSeconds *dynamicDesc
+	refreshDurationSeconds      *dynamicDesc
+
+	// Target-level descriptors (one series per configured URL)
+	targetUp                          *dynamicDesc
+	targetLastError                   *dynamicDesc
+	targetLastRefreshTimestampSeconds *dynamicDesc
+	targetRefreshDurationSeconds      *dynamicDesc
+	targetTLSCertExpiryTimestamp      *dynamicDesc
 }
 
 // NewCollector creates a new Collector
 func NewCollector(s *store.Store) *Collector {
 	return &Collector{
 		store: s,
-		up: prometheus.NewDesc(
+		up: newDynamicDesc(
 			"xui_subscription_up",
 			"Whether the subscription was successfully scraped and parsed (1=success, 0=failure)",
-			[]string{"sid"},
-			nil,
 		),
-		downloadBytes: prometheus.NewDesc(
+		info: newDynamicDesc(
+			"xui_subscription_info",
+			"Metadata of the subscription (sub_url, remark, email, source_target, when allowed by info_labels), always 1",
+		),
+		stale: newDynamicDesc(
+			"xui_subscription_stale",
+			"Whether the exported values were not produced by the latest refresh, e.g. restored from the state file (1=stale, 0=fresh)",
+		),
+		dataAgeSeconds: newDynamicDesc(
+			"xui_subscription_data_age_seconds",
+			"Seconds since the exported values were last successfully fetched",
+		),
+		downloadBytes: newDynamicDesc(
 			"xui_subscription_download_bytes",
 			"Downloaded bytes for the subscription",
-			[]string{"sid"},
-			nil,
 		),
-		uploadBytes: prometheus.NewDesc(
+		uploadBytes: newDynamicDesc(
 			"xui_subscription_upload_bytes",
 			"Uploaded bytes for the subscription",
-			[]string{"sid"},
-			nil,
 		),
-		quotaBytes: prometheus.NewDesc(
+		quotaBytes: newDynamicDesc(
 			"xui_subscription_quota_bytes",
 			"Total quota bytes for the subscription",
-			[]string{"sid"},
-			nil,
 		),
-		expireTimestampSeconds: prometheus.NewDesc(
+		expireTimestampSeconds: newDynamicDesc(
 			"xui_subscription_expire_timestamp_seconds",
 			"Expiration timestamp in Unix epoch seconds",
-			[]string{"sid"},
-			nil,
 		),
-		usedBytes: prometheus.NewDesc(
+		unlimitedQuota: newDynamicDesc(
+			"xui_subscription_unlimited_quota",
+			"Whether the subscription has no traffic quota (1=unlimited, 0=limited)",
+		),
+		noExpiry: newDynamicDesc(
+			"xui_subscription_no_expiry",
+			"Whether the subscription never expires (1=never expires, 0=has an expiry)",
+		),
+		usedBytes: newDynamicDesc(
 			"xui_subscription_used_bytes",
 			"Total used bytes (download + upload)",
-			[]string{"sid"},
-			nil,
 		),
-		remainingBytes: prometheus.NewDesc(
+		remainingBytes: newDynamicDesc(
 			"xui_subscription_remaining_bytes",
 			"Remaining bytes (quota - used, can be negative)",
-			[]string{"sid"},
-			nil,
 		),
-		usedRatio: prometheus.NewDesc(
+		usedRatio: newDynamicDesc(
 			"xui_subscription_used_ratio",
 			"Used bytes ratio (used / quota)",
-			[]string{"sid"},
-			nil,
 		),
-		remainingRatio: prometheus.NewDesc(
+		remainingRatio: newDynamicDesc(
 			"xui_subscription_remaining_ratio",
 			"Remaining bytes ratio (remaining / quota)",
-			[]string{"sid"},
-			nil,
 		),
-		secondsUntilExpire: prometheus.NewDesc(
+		secondsUntilExpire: newDynamicDesc(
 			"xui_subscription_seconds_until_expire",
 			"Seconds until expiration (can be negative if expired)",
-			[]string{"sid"},
-			nil,
 		),
-		daysUntilExpire: prometheus.NewDesc(
+		daysUntilExpire: newDynamicDesc(
 			"xui_subscription_days_until_expire",
 			"Days until expiration (seconds_until_expire / 86400)",
-			[]string{"sid"},
-			nil,
 		),
-		expired: prometheus.NewDesc(
+		expired: newDynamicDesc(
 			"xui_subscription_expired",
 			"Whether the subscription has expired (1=expired, 0=active)",
-			[]string{"sid"},
-			nil,
 		),
-		dailyBudgetBytes: prometheus.NewDesc(
+		dailyBudgetBytes: newDynamicDesc(
 			"xui_subscription_daily_budget_bytes",
 			"Average daily budget bytes from now until expiration (remaining / days_until_expire)",
-			[]string{"sid"},
-			nil,
 		),
-		lastRefreshTimestampSeconds: prometheus.NewDesc(
+		usageRate: newDynamicDesc(
+			"xui_subscription_usage_rate_bytes_per_second",
+			"Average used bytes per second over the window (only present once the history covers half the window)",
+		),
+		projectedExhaustion: newDynamicDesc(
+			"xui_subscription_projected_exhaustion_timestamp_seconds",
+			"Projected quota exhaustion timestamp at the usage rate of the longest available window",
+		),
+		willExhaustBeforeExpiry: newDynamicDesc(
+			"xui_subscription_will_exhaust_before_expiry",
+			"Whether the quota is projected to run out before the subscription expires (1=yes, 0=no)",
+		),
+		resetsTotal: newDynamicCounterDesc(
+			"xui_subscription_resets_total",
+			"Number of detected traffic resets (download or upload bytes decreased between refreshes)",
+		),
+		downloadBytesTotal: newDynamicCounterDesc(
+			"xui_subscription_download_bytes_total",
+			"Downloaded bytes accumulated across traffic resets",
+		),
+		uploadBytesTotal: newDynamicCounterDesc(
+			"xui_subscription_upload_bytes_total",
+			"Uploaded bytes accumulated across traffic resets",
+		),
+		usedBytesTotal: newDynamicCounterDesc(
+			"xui_subscription_used_bytes_total",
+			"Used bytes (download + upload) accumulated across traffic resets",
+		),
+		lastRefreshTimestampSeconds: newDynamicDesc(
 			"xui_subscription_last_refresh_timestamp_seconds",
 			"Timestamp of the last refresh attempt completion",
-			[]string{"sid"},
-			nil,
 		),
-		refreshDurationSeconds: prometheus.NewDesc(
+		refreshDurationSeconds: newDynamicDesc(
 			"xui_subscription_refresh_duration_seconds",
 			"Duration of the last refresh attempt in seconds",
-			[]string{"sid"},
-			nil,
+		),
+		targetUp: newDynamicDesc(
+			"xui_target_up",
+			"Whether the target was successfully fetched, parsed and validated (1=success, 0=failure)",
+		),
+		targetLastError: newDynamicDesc(
+			"xui_target_last_error",
+			"Reason of the last failed refresh attempt, always 1 (only present while the target is down)",
+		),
+		targetLastRefreshTimestampSeconds: newDynamicDesc(
+			"xui_target_last_refresh_timestamp_seconds",
+			"Timestamp of the last refresh attempt completion for the target",
+		),
+		targetRefreshDurationSeconds: newDynamicDesc(
+			"xui_target_refresh_duration_seconds",
+			"Duration of the last refresh attempt for the target in seconds",
+		),
+		targetTLSCertExpiryTimestamp: newDynamicDesc(
+			"xui_target_tls_cert_expiry_timestamp_seconds",
+			"Expiry (NotAfter) of the target's TLS leaf certificate in Unix epoch seconds",
 		),
 	}
 }
 
 // Describe implements prometheus.Collector
+// It sends no descriptors, making this an unchecked collector: the label
+// names depend on the extra labels of each subscription and the static
+// labels of each target, so descriptors are only known at collection time.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.up
-	ch <- c.downloadBytes
-	ch <- c.uploadBytes
-	ch <- c.quotaBytes
-	ch <- c.expireTimestampSeconds
-	ch <- c.usedBytes
-	ch <- c.remainingBytes
-	ch <- c.usedRatio
-	ch <- c.remainingRatio
-	ch <- c.secondsUntilExpire
-	ch <- c.daysUntilExpire
-	ch <- c.expired
-	ch <- c.dailyBudgetBytes
-	ch <- c.lastRefreshTimestampSeconds
-	ch <- c.refreshDurationSeconds
 }
 
 // Collect implements prometheus.Collector
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	snapshot := c.store.GetSnapshot()
+	now := float64(time.Now().Unix())
 
-	for sid, metrics := range snapshot {
-		labels := []string{sid}
+	for _, metrics := range snapshot {
+		labels := newSubscriptionLabels(metrics.SID, metrics.AllLabels())
 
 		// Always export up metric
-		ch <- prometheus.MustNewConstMetric(
-			c.up,
-			prometheus.GaugeValue,
-			boolToFloat64(metrics.Up),
-			labels...,
-		)
+		ch <- c.up.metric(boolToFloat64(metrics.Up), labels)
+
+		ch <- c.info.metric(1, infoLabels(labels, metrics.Info))
+
+		ch <- c.stale.metric(boolToFloat64(metrics.Stale), labels)
 
 		// Always export troubleshooting metrics (if available)
 		if metrics.LastRefreshTimestampSeconds > 0 {
-			ch <- prometheus.MustNewConstMetric(
-				c.lastRefreshTimestampSeconds,
-				prometheus.GaugeValue,
-				metrics.LastRefreshTimestampSeconds,
-				labels...,
-			)
+			ch <- c.lastRefreshTimestampSeconds.metric(metrics.LastRefreshTimestampSeconds, labels)
 		}
 
 		if metrics.RefreshDurationSeconds > 0 {
-			ch <- prometheus.MustNewConstMetric(
-				c.refreshDurationSeconds,
-				prometheus.GaugeValue,
-				metrics.RefreshDurationSeconds,
-				labels...,
-			)
+			ch <- c.refreshDurationSeconds.metric(metrics.RefreshDurationSeconds, labels)
 		}
 
-		// Only export other metrics if the subscription is up
-		if !metrics.Up {
+		// Only export other metrics if the subscription is up, or its last
+		// successful values are carried forward as stale
+		if !metrics.Up && !metrics.Stale {
 			continue
 		}
 
+		if metrics.LastSuccessTimestampSeconds > 0 {
+			ch <- c.dataAgeSeconds.metric(now-metrics.LastSuccessTimestampSeconds, labels)
+		}
+
 		// Raw metrics
-		ch <- prometheus.MustNewConstMetric(
-			c.downloadBytes,
-			prometheus.GaugeValue,
-			float64(metrics.DownloadBytes),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.uploadBytes,
-			prometheus.GaugeValue,
-			float64(metrics.UploadBytes),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.quotaBytes,
-			prometheus.GaugeValue,
-			float64(metrics.QuotaBytes),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.expireTimestampSeconds,
-			prometheus.GaugeValue,
-			float64(metrics.ExpireTimestampSeconds),
-			labels...,
-		)
-
-		// Derived metrics
-		ch <- prometheus.MustNewConstMetric(
-			c.usedBytes,
-			prometheus.GaugeValue,
-			float64(metrics.UsedBytes),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.remainingBytes,
-			prometheus.GaugeValue,
-			float64(metrics.RemainingBytes),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.usedRatio,
-			prometheus.GaugeValue,
-			metrics.UsedRatio,
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.remainingRatio,
-			prometheus.GaugeValue,
-			metrics.RemainingRatio,
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.secondsUntilExpire,
-			prometheus.GaugeValue,
-			float64(metrics.SecondsUntilExpire),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.daysUntilExpire,
-			prometheus.GaugeValue,
-			metrics.DaysUntilExpire,
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.expired,
-			prometheus.GaugeValue,
-			float64(metrics.Expired),
-			labels...,
-		)
-
-		ch <- prometheus.MustNewConstMetric(
-			c.dailyBudgetBytes,
-			prometheus.GaugeValue,
-			metrics.DailyBudgetBytes,
-			labels...,
-		)
+		ch <- c.downloadBytes.metric(float64(metrics.DownloadBytes), labels)
+
+		ch <- c.uploadBytes.metric(float64(metrics.UploadBytes), labels)
+
+		ch <- c.quotaBytes.metric(float64(metrics.QuotaBytes), labels)
+
+		ch <- c.expireTimestampSeconds.metric(float64(metrics.ExpireTimestampSeconds), labels)
+
+		ch <- c.unlimitedQuota.metric(boolToFloat64(metrics.UnlimitedQuota), labels)
+
+		ch <- c.noExpiry.metric(boolToFloat64(metrics.NoExpiry), labels)
+
+		// Derived metrics (those undefined for unlimited quota or no expiry are skipped)
+		ch <- c.usedBytes.metric(float64(metrics.UsedBytes), labels)
+
+		if !metrics.UnlimitedQuota {
+			ch <- c.remainingBytes.metric(float64(metrics.RemainingBytes), labels)
+
+			ch <- c.usedRatio.metric(metrics.UsedRatio, labels)
+
+			ch <- c.remainingRatio.metric(metrics.RemainingRatio, labels)
+		}
+
+		if !metrics.NoExpiry {
+			ch <- c.secondsUntilExpire.metric(float64(metrics.SecondsUntilExpire), labels)
+
+			ch <- c.daysUntilExpire.metric(metrics.DaysUntilExpire, labels)
+		}
+
+		ch <- c.expired.metric(float64(metrics.Expired), labels)
+
+		if !metrics.UnlimitedQuota && !metrics.NoExpiry {
+			ch <- c.dailyBudgetBytes.metric(metrics.DailyBudgetBytes, labels)
+		}
+
+		// Monotonic counters
+		ch <- c.resetsTotal.metric(float64(metrics.Resets), labels)
+
+		ch <- c.downloadBytesTotal.metric(float64(metrics.DownloadBytesTotal()), labels)
+
+		ch <- c.uploadBytesTotal.metric(float64(metrics.UploadBytesTotal()), labels)
+
+		ch <- c.usedBytesTotal.metric(float64(metrics.DownloadBytesTotal()+metrics.UploadBytesTotal()), labels)
+
+		// Usage rate metrics (absent until enough history is collected)
+		for _, rate := range metrics.UsageRates {
+			window := model.Duration(rate.Window).String()
+			ch <- c.usageRate.metric(rate.BytesPerSecond, labels.with(labelnames.Window, window))
+		}
+
+		if metrics.ProjectedExhaustionTimestampSeconds > 0 {
+			ch <- c.projectedExhaustion.metric(metrics.ProjectedExhaustionTimestampSeconds, labels)
+		}
+
+		if len(metrics.UsageRates) > 0 || metrics.ProjectedExhaustionTimestampSeconds > 0 {
+			ch <- c.willExhaustBeforeExpiry.metric(float64(metrics.WillExhaustBeforeExpiry), labels)
+		}
+	}
+
+	for _, target := range c.store.GetTargets() {
+		labels := newTargetLabels(target.Target, target.Labels)
+
+		ch <- c.targetUp.metric(boolToFloat64(target.Up), labels)
+
+		if !target.Up {
+			ch <- c.targetLastError.metric(1, labels.with(labelnames.Reason, target.Reason))
+		}
+
+		ch <- c.targetLastRefreshTimestampSeconds.metric(target.LastRefreshTimestampSeconds, labels)
+
+		ch <- c.targetRefreshDurationSeconds.metric(target.RefreshDurationSeconds, labels)
+
+		if target.TLSCertExpiryTimestampSeconds > 0 {
+			ch <- c.targetTLSCertExpiryTimestamp.metric(target.TLSCertExpiryTimestampSeconds, labels)
+		}
+	}
+}
+
+// infoLabels appends the known metadata fields to the labels of a subscription,
+// skipping fields already present as extra labels (e.g. email for panel clients)
+func infoLabels(labels labelSet, info compute.Info) labelSet {
+	fields := []struct{ name, value string }{
+		{compute.InfoSubURL, info.SubURL},
+		{compute.InfoRemark, info.Remark},
+		{compute.InfoEmail, info.Email},
+		{compute.InfoSourceTarget, info.SourceTarget},
+	}
+	for _, f := range fields {
+		if f.value != "" && !slices.Contains(labels.names, f.name) {
+			labels = labels.with(f.name, f.value)
+		}
 	}
+	return labels
 }
 
 // boolToFloat64 converts a boolean to float64 (1.0 for true, 0.0 for false)
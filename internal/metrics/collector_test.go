@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector_StaticLabels(t *testing.T) {
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "alice", Up: true, TargetLabels: map[string]string{"owner": "alice", "plan": "500g"}},
+	}, []store.TargetStatus{
+		{Target: "alice", Labels: map[string]string{"owner": "alice", "plan": "500g"}, Up: false, Reason: store.ReasonTimeout},
+	})
+
+	expected := `
+# HELP xui_subscription_up Whether the subscription was successfully scraped and parsed (1=success, 0=failure)
+# TYPE xui_subscription_up gauge
+xui_subscription_up{owner="alice",plan="500g",sid="sid1"} 1
+# HELP xui_target_up Whether the target was successfully fetched, parsed and validated (1=success, 0=failure)
+# TYPE xui_target_up gauge
+xui_target_up{owner="alice",plan="500g",target="alice"} 0
+# HELP xui_target_last_error Reason of the last failed refresh attempt, always 1 (only present while the target is down)
+# TYPE xui_target_last_error gauge
+xui_target_last_error{owner="alice",plan="500g",reason="timeout",target="alice"} 1
+`
+	err := testutil.CollectAndCompare(NewCollector(st), strings.NewReader(expected),
+		"xui_subscription_up", "xui_target_up", "xui_target_last_error")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollector_PanelLabels(t *testing.T) {
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {
+			SID:    "sid1",
+			Target: "panel-1",
+			Up:     true,
+			Labels: map[string]string{"inbound": "main", "email": "alice", "protocol": "vless"},
+			Info:   compute.Info{Remark: "main", Email: "alice", SourceTarget: "panel-1"},
+		},
+	}, nil)
+
+	// email is already a panel label, so the info metric does not repeat it
+	expected := `
+# HELP xui_subscription_up Whether the subscription was successfully scraped and parsed (1=success, 0=failure)
+# TYPE xui_subscription_up gauge
+xui_subscription_up{email="alice",inbound="main",protocol="vless",sid="sid1"} 1
+# HELP xui_subscription_info Metadata of the subscription (sub_url, remark, email, source_target, when allowed by info_labels), always 1
+# TYPE xui_subscription_info gauge
+xui_subscription_info{email="alice",inbound="main",protocol="vless",remark="main",sid="sid1",source_target="panel-1"} 1
+`
+	err := testutil.CollectAndCompare(NewCollector(st), strings.NewReader(expected),
+		"xui_subscription_up", "xui_subscription_info")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollector_UnlimitedAndNoExpiry(t *testing.T) {
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"unlimited": {SID: "unlimited", Up: true, UnlimitedQuota: true, UsedBytes: 100, SecondsUntilExpire: 86400, DaysUntilExpire: 1},
+		"forever":   {SID: "forever", Up: true, NoExpiry: true, QuotaBytes: 1000, UsedBytes: 100, RemainingBytes: 900, UsedRatio: 0.1, RemainingRatio: 0.9},
+	}, nil)
+
+	// Ratios need a quota, days left need an expiry, the daily budget needs both
+	expected := `
+# HELP xui_subscription_remaining_bytes Remaining bytes (quota - used, can be negative)
+# TYPE xui_subscription_remaining_bytes gauge
+xui_subscription_remaining_bytes{sid="forever"} 900
+# HELP xui_subscription_used_ratio Used bytes ratio (used / quota)
+# TYPE xui_subscription_used_ratio gauge
+xui_subscription_used_ratio{sid="forever"} 0.1
+# HELP xui_subscription_remaining_ratio Remaining bytes ratio (remaining / quota)
+# TYPE xui_subscription_remaining_ratio gauge
+xui_subscription_remaining_ratio{sid="forever"} 0.9
+# HELP xui_subscription_days_until_expire Days until expiration (seconds_until_expire / 86400)
+# TYPE xui_subscription_days_until_expire gauge
+xui_subscription_days_until_expire{sid="unlimited"} 1
+# HELP xui_subscription_seconds_until_expire Seconds until expiration (can be negative if expired)
+# TYPE xui_subscription_seconds_until_expire gauge
+xui_subscription_seconds_until_expire{sid="unlimited"} 86400
+# HELP xui_subscription_unlimited_quota Whether the subscription has no traffic quota (1=unlimited, 0=limited)
+# TYPE xui_subscription_unlimited_quota gauge
+xui_subscription_unlimited_quota{sid="forever"} 0
+xui_subscription_unlimited_quota{sid="unlimited"} 1
+`
+	err := testutil.CollectAndCompare(NewCollector(st), strings.NewReader(expected),
+		"xui_subscription_remaining_bytes", "xui_subscription_used_ratio", "xui_subscription_remaining_ratio",
+		"xui_subscription_days_until_expire", "xui_subscription_seconds_until_expire",
+		"xui_subscription_daily_budget_bytes", "xui_subscription_unlimited_quota")
+	if err != nil {
+		t.Error(err)
+	}
+}
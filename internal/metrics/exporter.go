@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/methol/xui-exporter/internal/version"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exporter self-instrumentation metrics, registered next to Collector
+var (
+	ConfigLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "xui_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful (1=success, 0=failure)",
+	})
+
+	ConfigLastReloadSuccessTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "xui_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload",
+	})
+
+	FetchRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xui_fetch_retries_total",
+		Help: "Total number of fetch retries after failed attempts",
+	}, []string{"target"})
+
+	RefreshDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "xui_exporter_refresh_duration_seconds",
+		Help:    "Duration of target refreshes",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"target"})
+
+	LastSuccessfulRefreshTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xui_exporter_last_successful_refresh_timestamp_seconds",
+		Help: "Timestamp of the last refresh in which the target was up",
+	}, []string{"target"})
+
+	RefreshCycleDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "xui_exporter_refresh_cycle_duration_seconds",
+		Help:    "Duration of refresh cycles, from the start of the first to the end of the last target refresh of a round over all targets",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	LastSuccessfulRefreshCycleTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "xui_exporter_last_successful_refresh_cycle_timestamp_seconds",
+		Help: "Timestamp of the end of the last refresh cycle in which every target was up",
+	})
+
+	RefreshErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xui_exporter_refresh_errors_total",
+		Help: "Total number of failed target refreshes by error class (network, timeout, http_status, auth, parse, validation)",
+	}, []string{"target", "class"})
+
+	FetchDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "xui_exporter_fetch_duration_seconds",
+		Help:    "Duration of fetch attempt phases (dns, connect, tls, ttfb, total)",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"target", "phase"})
+
+	FetchResponseSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "xui_exporter_fetch_response_size_bytes",
+		Help:    "Body size of successful fetch responses",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+	}, []string{"target"})
+)
+
+// FetchObserver records the fetch phase durations and response sizes of a target.
+// It implements fetch.Observer.
+type FetchObserver struct {
+	Target string
+}
+
+// ObservePhase records the duration of a fetch phase
+func (o FetchObserver) ObservePhase(phase string, d time.Duration) {
+	FetchDurationSeconds.WithLabelValues(o.Target, phase).Observe(d.Seconds())
+}
+
+// ObserveResponseSize records the body size of a response
+func (o FetchObserver) ObserveResponseSize(bytes int) {
+	FetchResponseSizeBytes.WithLabelValues(o.Target).Observe(float64(bytes))
+}
+
+// DeleteTarget drops the series of a target that is no longer configured
+func DeleteTarget(target string) {
+	labels := prometheus.Labels{"target": target}
+	FetchRetriesTotal.DeletePartialMatch(labels)
+	RefreshErrorsTotal.DeletePartialMatch(labels)
+	RefreshDurationSeconds.DeletePartialMatch(labels)
+	LastSuccessfulRefreshTimestampSeconds.DeletePartialMatch(labels)
+	FetchDurationSeconds.DeletePartialMatch(labels)
+	FetchResponseSizeBytes.DeletePartialMatch(labels)
+}
+
+// newBuildInfo creates the constant xui_exporter_build_info gauge
+func newBuildInfo() prometheus.Collector {
+	info := version.Get()
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "xui_exporter_build_info",
+		Help: "Build information of the exporter, always 1",
+		ConstLabels: prometheus.Labels{
+			"version":   info.Version,
+			"revision":  info.Revision,
+			"goversion": info.GoVersion,
+		},
+	}, func() float64 { return 1 })
+}
+
+// RegisterExporterMetrics registers the exporter self-instrumentation metrics
+func RegisterExporterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		newBuildInfo(),
+		ConfigLastReloadSuccessful,
+		ConfigLastReloadSuccessTimestampSeconds,
+		FetchRetriesTotal,
+		RefreshDurationSeconds,
+		LastSuccessfulRefreshTimestampSeconds,
+		RefreshCycleDurationSeconds,
+		LastSuccessfulRefreshCycleTimestampSeconds,
+		RefreshErrorsTotal,
+		FetchDurationSeconds,
+		FetchResponseSizeBytes,
+	)
+}
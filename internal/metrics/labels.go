@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/methol/xui-exporter/internal/labelnames"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelSet holds the label names and values of a series: the identifying
+// label (sid or target) first, then the extra labels sorted by name
+type labelSet struct {
+	names  []string
+	values []string
+	key    string
+}
+
+// newSubscriptionLabels builds the labels for a subscription
+func newSubscriptionLabels(sid string, extra map[string]string) labelSet {
+	return newLabelSet(labelnames.SID, sid, extra)
+}
+
+// newTargetLabels builds the labels for a target
+func newTargetLabels(target string, extra map[string]string) labelSet {
+	return newLabelSet(labelnames.Target, target, extra)
+}
+
+// newLabelSet builds the labels of a series identified by the label name=value
+func newLabelSet(name, value string, extra map[string]string) labelSet {
+	names := make([]string, 0, len(extra)+1)
+	for n := range extra {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names)+1)
+	values = append(values, value)
+	for _, n := range names {
+		values = append(values, extra[n])
+	}
+	names = append([]string{name}, names...)
+
+	return labelSet{
+		names:  names,
+		values: values,
+		key:    strings.Join(names, "\xff"),
+	}
+}
+
+// with returns a copy of l with an additional label appended
+func (l labelSet) with(name, value string) labelSet {
+	names := append(append(make([]string, 0, len(l.names)+1), l.names...), name)
+	values := append(append(make([]string, 0, len(l.values)+1), l.values...), value)
+	return labelSet{
+		names:  names,
+		values: values,
+		key:    l.key + "\xff" + name,
+	}
+}
+
+// dynamicDesc describes a metric whose label names vary with the extra labels
+// of each subscription or target. Descriptors are created lazily for each
+// label name set and cached.
+type dynamicDesc struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+
+	mu    sync.Mutex
+	descs map[string]*prometheus.Desc
+}
+
+// newDynamicDesc creates a dynamicDesc for a gauge
+func newDynamicDesc(name, help string) *dynamicDesc {
+	return &dynamicDesc{
+		name:      name,
+		help:      help,
+		valueType: prometheus.GaugeValue,
+		descs:     make(map[string]*prometheus.Desc),
+	}
+}
+
+// newDynamicCounterDesc creates a dynamicDesc for a counter
+func newDynamicCounterDesc(name, help string) *dynamicDesc {
+	d := newDynamicDesc(name, help)
+	d.valueType = prometheus.CounterValue
+	return d
+}
+
+// metric returns a sample for the given labels
+func (d *dynamicDesc) metric(value float64, labels labelSet) prometheus.Metric {
+	d.mu.Lock()
+	desc, ok := d.descs[labels.key]
+	if !ok {
+		desc = prometheus.NewDesc(d.name, d.help, labels.names, nil)
+		d.descs[labels.key] = desc
+	}
+	d.mu.Unlock()
+
+	return prometheus.MustNewConstMetric(desc, d.valueType, value, labels.values...)
+}
@@ -0,0 +1,30 @@
+package parse
+
+import (
+	"fmt"
+
+	yaml "go.yaml.in/yaml/v2"
+)
+
+// clashConfig is the part of a Clash configuration used to recognize it
+type clashConfig struct {
+	Proxies        []interface{}          `yaml:"proxies"`
+	ProxyProviders map[string]interface{} `yaml:"proxy-providers"`
+}
+
+// ValidateClashConfig checks that yamlBytes is a Clash configuration with at
+// least one proxy or proxy provider. Clash configurations carry no traffic
+// data themselves; it is read from the Subscription-Userinfo header, and this
+// check rejects error pages served with a stale header.
+func ValidateClashConfig(yamlBytes []byte) error {
+	var cfg clashConfig
+	if err := yaml.Unmarshal(yamlBytes, &cfg); err != nil {
+		return fmt.Errorf("failed to parse Clash YAML: %w", err)
+	}
+
+	if len(cfg.Proxies) == 0 && len(cfg.ProxyProviders) == 0 {
+		return fmt.Errorf("Clash config has no proxies or proxy-providers")
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package parse
+
+import "testing"
+
+func TestValidateClashConfig(t *testing.T) {
+	valid := []byte(`
+mixed-port: 7890
+proxies:
+  - name: node-1
+    type: vless
+    server: example.com
+    port: 443
+`)
+	if err := ValidateClashConfig(valid); err != nil {
+		t.Errorf("Expected success, got error: %v", err)
+	}
+
+	providers := []byte(`
+proxy-providers:
+  remote:
+    type: http
+    url: https://example.com/sub
+`)
+	if err := ValidateClashConfig(providers); err != nil {
+		t.Errorf("Expected success for proxy-providers, got error: %v", err)
+	}
+
+	tests := map[string]string{
+		"html page":  "<html><body>Not Found</body></html>",
+		"no proxies": "mixed-port: 7890\n",
+		"bad yaml":   "proxies: [",
+	}
+	for name, body := range tests {
+		if err := ValidateClashConfig([]byte(body)); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/methol/xui-exporter/internal/labelnames"
+)
+
+// panelInboundsResponse is the JSON envelope of the 3x-ui inbounds list API
+type panelInboundsResponse struct {
+	Success bool           `json:"success"`
+	Msg     string         `json:"msg"`
+	Obj     []panelInbound `json:"obj"`
+}
+
+// panelInbound is a single inbound of the inbounds list API
+type panelInbound struct {
+	ID          int                `json:"id"`
+	Remark      string             `json:"remark"`
+	Tag         string             `json:"tag"`
+	Protocol    string             `json:"protocol"`
+	Settings    string             `json:"settings"`
+	ClientStats []panelClientStats `json:"clientStats"`
+}
+
+// panelClientStats is the traffic record of a client
+type panelClientStats struct {
+	Email      string `json:"email"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Total      int64  `json:"total"`
+	ExpiryTime int64  `json:"expiryTime"` // milliseconds; negative: duration starting at first use
+}
+
+// panelSettings is the client list embedded as a JSON string in inbound settings
+type panelSettings struct {
+	Clients []struct {
+		Email string `json:"email"`
+		SubID string `json:"subId"`
+	} `json:"clients"`
+}
+
+// ParsePanelInbounds parses the JSON of the 3x-ui inbounds list API into one
+// ParsedSubscription per client. The SID is the client's subId, falling back
+// to its email; Labels carry the inbound remark, email and protocol, and the
+// metadata the inbound remark and client email.
+// Unlike ParseSubscription, field values are not validated here: one client
+// with an invalid quota must not fail the whole panel. Clients without an
+// email cannot be identified and are skipped; their number is returned.
+func ParsePanelInbounds(jsonBytes []byte) ([]ParsedSubscription, int, error) {
+	var resp panelInboundsResponse
+	if err := json.Unmarshal(jsonBytes, &resp); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse inbounds JSON: %w", err)
+	}
+
+	if !resp.Success {
+		return nil, 0, fmt.Errorf("inbounds list API returned success=false: %s", resp.Msg)
+	}
+
+	var subscriptions []ParsedSubscription
+	skipped := 0
+	for _, inbound := range resp.Obj {
+		subIDs := make(map[string]string)
+		if inbound.Settings != "" {
+			var settings panelSettings
+			if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+				return nil, 0, fmt.Errorf("inbound %d: failed to parse settings: %w", inbound.ID, err)
+			}
+			for _, client := range settings.Clients {
+				subIDs[client.Email] = client.SubID
+			}
+		}
+
+		name := inbound.Remark
+		if name == "" {
+			name = inbound.Tag
+		}
+
+		for _, stats := range inbound.ClientStats {
+			if stats.Email == "" {
+				skipped++
+				continue
+			}
+
+			sid := subIDs[stats.Email]
+			if sid == "" {
+				sid = stats.Email
+			}
+
+			// A negative expiry is a duration that starts at the first use
+			// ("start after first use"), so the client does not expire yet
+			expire := stats.ExpiryTime / 1000
+			notStarted := stats.ExpiryTime < 0
+			if notStarted {
+				expire = 0
+			}
+
+			subscriptions = append(subscriptions, ParsedSubscription{
+				SID:              sid,
+				DownloadByte:     stats.Down,
+				UploadByte:       stats.Up,
+				TotalByte:        stats.Total,
+				Expire:           expire,
+				ExpiryNotStarted: notStarted,
+				Labels: map[string]string{
+					labelnames.Inbound:  name,
+					labelnames.Email:    stats.Email,
+					labelnames.Protocol: inbound.Protocol,
+				},
+				Remark: inbound.Remark,
+				Email:  stats.Email,
+			})
+		}
+	}
+
+	return subscriptions, skipped, nil
+}
@@ -0,0 +1,135 @@
+package parse
+
+import (
+	"testing"
+)
+
+const panelInboundsJSON = `{
+  "success": true,
+  "msg": "",
+  "obj": [
+    {
+      "id": 1,
+      "remark": "main",
+      "tag": "inbound-443",
+      "protocol": "vless",
+      "settings": "{\"clients\":[{\"id\":\"uuid-1\",\"email\":\"alice\",\"subId\":\"uk2jf33cdnzjn2dg\"},{\"id\":\"uuid-2\",\"email\":\"bob\",\"subId\":\"\"}]}",
+      "clientStats": [
+        {"id": 1, "inboundId": 1, "email": "alice", "up": 267143927, "down": 6150124543, "total": 536870912000, "expiryTime": 1769184000000},
+        {"id": 2, "inboundId": 1, "email": "bob", "up": 1, "down": 2, "total": 0, "expiryTime": 0}
+      ]
+    },
+    {
+      "id": 2,
+      "remark": "",
+      "tag": "inbound-8443",
+      "protocol": "trojan",
+      "settings": "{\"clients\":[]}",
+      "clientStats": []
+    }
+  ]
+}`
+
+func TestParsePanelInbounds_Success(t *testing.T) {
+	result, _, err := ParsePanelInbounds([]byte(panelInboundsJSON))
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 clients, got %d", len(result))
+	}
+
+	alice := result[0]
+	if alice.SID != "uk2jf33cdnzjn2dg" {
+		t.Errorf("Expected SID from subId 'uk2jf33cdnzjn2dg', got '%s'", alice.SID)
+	}
+
+	if alice.DownloadByte != 6150124543 || alice.UploadByte != 267143927 {
+		t.Errorf("Unexpected traffic: down=%d up=%d", alice.DownloadByte, alice.UploadByte)
+	}
+
+	if alice.TotalByte != 536870912000 {
+		t.Errorf("Expected TotalByte 536870912000, got %d", alice.TotalByte)
+	}
+
+	if alice.Expire != 1769184000 {
+		t.Errorf("Expected Expire in seconds 1769184000, got %d", alice.Expire)
+	}
+
+	if alice.Labels["inbound"] != "main" || alice.Labels["email"] != "alice" || alice.Labels["protocol"] != "vless" {
+		t.Errorf("Unexpected labels: %v", alice.Labels)
+	}
+
+	// Clients without subId fall back to the email, values are not validated
+	bob := result[1]
+	if bob.SID != "bob" {
+		t.Errorf("Expected SID fallback to email 'bob', got '%s'", bob.SID)
+	}
+
+	if bob.TotalByte != 0 {
+		t.Errorf("Expected unvalidated TotalByte 0, got %d", bob.TotalByte)
+	}
+}
+
+func TestParsePanelInbounds_NotSuccessful(t *testing.T) {
+	_, _, err := ParsePanelInbounds([]byte(`{"success": false, "msg": "unauthorized", "obj": null}`))
+	if err == nil {
+		t.Fatal("Expected error for success=false, got nil")
+	}
+}
+
+func TestParsePanelInbounds_InvalidJSON(t *testing.T) {
+	_, _, err := ParsePanelInbounds([]byte(`<html>login</html>`))
+	if err == nil {
+		t.Fatal("Expected error for invalid JSON, got nil")
+	}
+}
+
+func TestParsePanelInbounds_SkipsClientWithoutEmail(t *testing.T) {
+	result, skipped, err := ParsePanelInbounds([]byte(`{
+  "success": true,
+  "obj": [
+    {
+      "id": 1,
+      "remark": "main",
+      "protocol": "vless",
+      "clientStats": [
+        {"email": "", "up": 1, "down": 2, "total": 100, "expiryTime": 0},
+        {"email": "alice", "up": 1, "down": 2, "total": 100, "expiryTime": 0}
+      ]
+    }
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if len(result) != 1 || result[0].SID != "alice" || skipped != 1 {
+		t.Errorf("Expected only alice and 1 skipped client, got %+v (skipped %d)", result, skipped)
+	}
+}
+
+func TestParsePanelInbounds_StartAfterFirstUse(t *testing.T) {
+	// 3x-ui stores "start after first use" as the negative duration in milliseconds
+	result, _, err := ParsePanelInbounds([]byte(`{
+  "success": true,
+  "obj": [
+    {
+      "id": 1,
+      "remark": "main",
+      "protocol": "vless",
+      "clientStats": [
+        {"email": "alice", "up": 0, "down": 0, "total": 100, "expiryTime": -2592000000}
+      ]
+    }
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if len(result) != 1 || result[0].Expire != 0 || !result[0].ExpiryNotStarted {
+		t.Errorf("Expected a not started expiry, got %+v", result)
+	}
+}
@@ -15,12 +15,52 @@ type ParsedSubscription struct {
 	UploadByte   int64
 	TotalByte    int64
 	Expire       int64
+
+	// ExpiryNotStarted is set for panel clients whose expiry only starts
+	// counting at their first use (Expire is 0 until then)
+	ExpiryNotStarted bool
+
+	// Labels are extra labels identifying the subscription within its
+	// source (e.g. inbound, email and protocol for panel clients)
+	Labels map[string]string
+
+	// Optional descriptive metadata, empty when the source does not provide it
+	SubURL string
+	Remark string
+	Email  string
+}
+
+// Options relaxes the validation of parsed values
+type Options struct {
+	// AllowUnlimited accepts a total of 0 (unlimited quota) and an expire
+	// of 0 (never expires), which x-ui uses for such subscriptions
+	AllowUnlimited bool
+}
+
+// checkLimit validates a quota or expire value: positive, or 0 when unlimited values are allowed
+func (o Options) checkLimit(name string, value int64) error {
+	if o.AllowUnlimited {
+		if value < 0 {
+			return fmt.Errorf("%s must be non-negative (got %d)", name, value)
+		}
+		return nil
+	}
+	if value <= 0 {
+		return fmt.Errorf("%s must be positive (got %d)", name, value)
+	}
+	return nil
 }
 
 // ParseSubscription parses the subscription HTML and extracts data from
-// template#subscription-data element's data-* attributes.
+// template#subscription-data element's data-* attributes. The optional
+// data-sub-url, data-remark and data-email attributes fill in the metadata.
 // Returns ParsedSubscription on success, or error if parsing/validation fails.
 func ParseSubscription(htmlBytes []byte) (ParsedSubscription, error) {
+	return ParseSubscriptionOptions(htmlBytes, Options{})
+}
+
+// ParseSubscriptionOptions is like ParseSubscription with relaxed validation
+func ParseSubscriptionOptions(htmlBytes []byte, opts Options) (ParsedSubscription, error) {
 	doc, err := html.Parse(strings.NewReader(string(htmlBytes)))
 	if err != nil {
 		return ParsedSubscription{}, fmt.Errorf("failed to parse HTML: %w", err)
@@ -62,12 +102,12 @@ func ParseSubscription(htmlBytes []byte) (ParsedSubscription, error) {
 	}
 
 	// Validate field values according to requirements
-	if totalByte <= 0 {
-		return ParsedSubscription{}, fmt.Errorf("data-totalbyte must be positive (got %d)", totalByte)
+	if err := opts.checkLimit("data-totalbyte", totalByte); err != nil {
+		return ParsedSubscription{}, err
 	}
 
-	if expire <= 0 {
-		return ParsedSubscription{}, fmt.Errorf("data-expire must be positive (got %d)", expire)
+	if err := opts.checkLimit("data-expire", expire); err != nil {
+		return ParsedSubscription{}, err
 	}
 
 	if downloadByte < 0 {
@@ -84,6 +124,9 @@ func ParseSubscription(htmlBytes []byte) (ParsedSubscription, error) {
 		UploadByte:   uploadByte,
 		TotalByte:    totalByte,
 		Expire:       expire,
+		SubURL:       attrs["data-sub-url"],
+		Remark:       attrs["data-remark"],
+		Email:        attrs["data-email"],
 	}, nil
 }
 
@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -43,6 +44,35 @@ func TestParseSubscription_Success(t *testing.T) {
 	}
 }
 
+func TestParseSubscription_Metadata(t *testing.T) {
+	html := `<template id="subscription-data"
+  data-sid="sid1"
+  data-sub-url="https://example.com/sub/sid1"
+  data-email="alice@example.com"
+  data-downloadbyte="1"
+  data-uploadbyte="2"
+  data-totalbyte="1000"
+  data-expire="1769184000"
+></template>`
+
+	result, err := ParseSubscription([]byte(html))
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if result.SubURL != "https://example.com/sub/sid1" {
+		t.Errorf("Expected SubURL 'https://example.com/sub/sid1', got '%s'", result.SubURL)
+	}
+
+	if result.Email != "alice@example.com" {
+		t.Errorf("Expected Email 'alice@example.com', got '%s'", result.Email)
+	}
+
+	if result.Remark != "" {
+		t.Errorf("Expected empty Remark, got '%s'", result.Remark)
+	}
+}
+
 func TestParseSubscription_MissingTemplate(t *testing.T) {
 	html := `<html><body><div>No template here</div></body></html>`
 
@@ -108,6 +138,35 @@ func TestParseSubscription_ZeroQuota(t *testing.T) {
 	}
 }
 
+func TestParseSubscriptionOptions_AllowUnlimited(t *testing.T) {
+	html := `<html>
+<body>
+<template id="subscription-data"
+  data-sid="test123"
+  data-downloadbyte="6150124543"
+  data-uploadbyte="267143927"
+  data-totalbyte="0"
+  data-expire="0"
+></template>
+</body>
+</html>`
+
+	result, err := ParseSubscriptionOptions([]byte(html), Options{AllowUnlimited: true})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if result.TotalByte != 0 || result.Expire != 0 {
+		t.Errorf("Expected TotalByte and Expire 0, got %d and %d", result.TotalByte, result.Expire)
+	}
+
+	// Negative values are still rejected
+	negative := strings.Replace(html, `data-expire="0"`, `data-expire="-1"`, 1)
+	if _, err := ParseSubscriptionOptions([]byte(negative), Options{AllowUnlimited: true}); err == nil {
+		t.Error("Expected error for negative expire, got nil")
+	}
+}
+
 func TestParseSubscription_NegativeExpire(t *testing.T) {
 	html := `<html>
 <body>
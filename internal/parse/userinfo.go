@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UserinfoHeader is the response header carrying traffic data on raw subscription endpoints
+const UserinfoHeader = "Subscription-Userinfo"
+
+// ParseUserinfo parses a Subscription-Userinfo header value of the form
+// "upload=..; download=..; total=..; expire=..".
+// The header carries no SID, so the caller must supply one (see SIDFromURL).
+// Validation rules are the same as ParseSubscription.
+func ParseUserinfo(value string, sid string) (ParsedSubscription, error) {
+	return ParseUserinfoOptions(value, sid, Options{})
+}
+
+// ParseUserinfoOptions is like ParseUserinfo with relaxed validation
+func ParseUserinfoOptions(value string, sid string, opts Options) (ParsedSubscription, error) {
+	if sid == "" {
+		return ParsedSubscription{}, fmt.Errorf("sid is empty")
+	}
+
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		attrs[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+	}
+
+	uploadByte, err := parseUserinfoInt64(attrs, "upload")
+	if err != nil {
+		return ParsedSubscription{}, fmt.Errorf("upload: %w", err)
+	}
+
+	downloadByte, err := parseUserinfoInt64(attrs, "download")
+	if err != nil {
+		return ParsedSubscription{}, fmt.Errorf("download: %w", err)
+	}
+
+	totalByte, err := parseUserinfoInt64(attrs, "total")
+	if err != nil {
+		return ParsedSubscription{}, fmt.Errorf("total: %w", err)
+	}
+
+	expire, err := parseUserinfoInt64(attrs, "expire")
+	if err != nil {
+		return ParsedSubscription{}, fmt.Errorf("expire: %w", err)
+	}
+
+	// Validate field values according to requirements
+	if err := opts.checkLimit("total", totalByte); err != nil {
+		return ParsedSubscription{}, err
+	}
+
+	if err := opts.checkLimit("expire", expire); err != nil {
+		return ParsedSubscription{}, err
+	}
+
+	if downloadByte < 0 {
+		return ParsedSubscription{}, fmt.Errorf("download must be non-negative (got %d)", downloadByte)
+	}
+
+	if uploadByte < 0 {
+		return ParsedSubscription{}, fmt.Errorf("upload must be non-negative (got %d)", uploadByte)
+	}
+
+	return ParsedSubscription{
+		SID:          sid,
+		DownloadByte: downloadByte,
+		UploadByte:   uploadByte,
+		TotalByte:    totalByte,
+		Expire:       expire,
+	}, nil
+}
+
+// SIDFromURL derives the SID from the last non-empty path segment of a
+// subscription URL such as http://example.com/sub/<sid>
+func SIDFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	sid := segments[len(segments)-1]
+	if sid == "" {
+		return "", fmt.Errorf("no path segment to derive sid from")
+	}
+
+	return sid, nil
+}
+
+// parseUserinfoInt64 parses an int64 from the userinfo map.
+// Some providers emit floating point values, which are truncated.
+func parseUserinfoInt64(attrs map[string]string, key string) (int64, error) {
+	val, ok := attrs[key]
+	if !ok {
+		return 0, fmt.Errorf("field %s not found", key)
+	}
+
+	parsed, err := strconv.ParseInt(val, 10, 64)
+	if err == nil {
+		return parsed, nil
+	}
+
+	f, ferr := strconv.ParseFloat(val, 64)
+	if ferr != nil {
+		return 0, fmt.Errorf("invalid integer value: %w", err)
+	}
+
+	return int64(f), nil
+}
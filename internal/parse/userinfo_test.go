@@ -0,0 +1,92 @@
+package parse
+
+import (
+	"testing"
+)
+
+func TestParseUserinfo_Success(t *testing.T) {
+	header := "upload=267143927; download=6150124543; total=536870912000; expire=1769184000"
+
+	result, err := ParseUserinfo(header, "uk2jf33cdnzjn2dg")
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if result.SID != "uk2jf33cdnzjn2dg" {
+		t.Errorf("Expected SID 'uk2jf33cdnzjn2dg', got '%s'", result.SID)
+	}
+
+	if result.DownloadByte != 6150124543 {
+		t.Errorf("Expected DownloadByte 6150124543, got %d", result.DownloadByte)
+	}
+
+	if result.UploadByte != 267143927 {
+		t.Errorf("Expected UploadByte 267143927, got %d", result.UploadByte)
+	}
+
+	if result.TotalByte != 536870912000 {
+		t.Errorf("Expected TotalByte 536870912000, got %d", result.TotalByte)
+	}
+
+	if result.Expire != 1769184000 {
+		t.Errorf("Expected Expire 1769184000, got %d", result.Expire)
+	}
+}
+
+func TestParseUserinfo_NoSpacesAndFloats(t *testing.T) {
+	header := "upload=1.5e3;download=2000;total=1e6;expire=1769184000"
+
+	result, err := ParseUserinfo(header, "test123")
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if result.UploadByte != 1500 {
+		t.Errorf("Expected UploadByte 1500, got %d", result.UploadByte)
+	}
+
+	if result.TotalByte != 1000000 {
+		t.Errorf("Expected TotalByte 1000000, got %d", result.TotalByte)
+	}
+}
+
+func TestParseUserinfo_MissingField(t *testing.T) {
+	header := "upload=0; download=0; expire=1769184000"
+
+	_, err := ParseUserinfo(header, "test123")
+	if err == nil {
+		t.Fatal("Expected error for missing total, got nil")
+	}
+}
+
+func TestParseUserinfo_ZeroQuota(t *testing.T) {
+	header := "upload=0; download=0; total=0; expire=1769184000"
+
+	_, err := ParseUserinfo(header, "test123")
+	if err == nil {
+		t.Fatal("Expected error for zero quota, got nil")
+	}
+}
+
+func TestSIDFromURL(t *testing.T) {
+	tests := map[string]string{
+		"http://example.com/sub/uk2jf33cdnzjn2dg":        "uk2jf33cdnzjn2dg",
+		"https://example.com:2096/sub/abc/":              "abc",
+		"https://example.com/path/sub/abc?format=base64": "abc",
+	}
+
+	for input, expected := range tests {
+		sid, err := SIDFromURL(input)
+		if err != nil {
+			t.Errorf("SIDFromURL(%q): unexpected error: %v", input, err)
+			continue
+		}
+		if sid != expected {
+			t.Errorf("SIDFromURL(%q): expected '%s', got '%s'", input, expected, sid)
+		}
+	}
+
+	if _, err := SIDFromURL("http://example.com/"); err == nil {
+		t.Error("Expected error for URL without path, got nil")
+	}
+}
@@ -0,0 +1,22 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+)
+
+// URL replaces everything after the host of a target URL with a short hash of
+// the full URL, so the result identifies the target without exposing the SID
+// or secret path tokens. Unparseable input is hashed entirely.
+func URL(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	token := "redacted-" + hex.EncodeToString(sum[:4])
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return token
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + token
+}
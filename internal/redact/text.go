@@ -0,0 +1,71 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// urlRE matches http(s) URLs in free text, stopping at whitespace and quotes
+var urlRE = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// redactedPathRE matches the path of a URL already redacted by URL
+var redactedPathRE = regexp.MustCompile(`^/redacted-[0-9a-f]{8}$`)
+
+// Text masks the path tokens of every http(s) URL in s, as URL does.
+// Trailing punctuation is not considered part of a URL, and URLs that are
+// already redacted are kept as is.
+func Text(s string) string {
+	return urlRE.ReplaceAllStringFunc(s, func(match string) string {
+		u := strings.TrimRight(match, ".,:;!?)")
+		suffix := match[len(u):]
+
+		if i := strings.Index(u, "://"); i >= 0 {
+			rest := u[i+3:]
+			if j := strings.IndexByte(rest, '/'); j >= 0 && redactedPathRE.MatchString(rest[j:]) {
+				return match
+			}
+		}
+		return URL(u) + suffix
+	})
+}
+
+// SID replaces a subscription ID with a stable keyed hash, so the result
+// identifies the subscription without being usable to fetch it
+func SID(sid, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(sid))
+	return "sid-" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// Writer masks URLs (see Text) in everything written to the underlying
+// writer while enabled. Used as the log output in privacy mode.
+type Writer struct {
+	w       io.Writer
+	enabled atomic.Bool
+}
+
+// NewWriter creates a disabled Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// SetEnabled turns masking on or off
+func (w *Writer) SetEnabled(enabled bool) {
+	w.enabled.Store(enabled)
+}
+
+// Write implements io.Writer
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.enabled.Load() {
+		return w.w.Write(p)
+	}
+	if _, err := io.WriteString(w.w, Text(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
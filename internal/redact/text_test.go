@@ -0,0 +1,58 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	raw := `Failed to fetch https://example.com/sub/uk2jf33cdnzjn2dg: Get "https://example.com/sub/uk2jf33cdnzjn2dg": timeout`
+	masked := Text(raw)
+
+	if strings.Contains(masked, "uk2jf33cdnzjn2dg") {
+		t.Errorf("Expected the SID to be masked, got '%s'", masked)
+	}
+
+	want := URL("https://example.com/sub/uk2jf33cdnzjn2dg")
+	if strings.Count(masked, want) != 2 {
+		t.Errorf("Expected both URLs to be replaced by '%s', got '%s'", want, masked)
+	}
+
+	if Text(masked) != masked {
+		t.Errorf("Expected redacted URLs to be kept, got '%s'", Text(masked))
+	}
+}
+
+func TestSID(t *testing.T) {
+	a := SID("uk2jf33cdnzjn2dg", "key")
+
+	if !strings.HasPrefix(a, "sid-") || strings.Contains(a, "uk2jf33cdnzjn2dg") {
+		t.Errorf("Expected a hashed SID, got '%s'", a)
+	}
+
+	if a != SID("uk2jf33cdnzjn2dg", "key") {
+		t.Error("Expected hashing to be stable")
+	}
+
+	if a == SID("uk2jf33cdnzjn2dg", "other") {
+		t.Error("Expected the hash to depend on the key")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.Write([]byte("https://example.com/sub/sid1\n"))
+	w.SetEnabled(true)
+	w.Write([]byte("https://example.com/sub/sid1\n"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "https://example.com/sub/sid1" {
+		t.Errorf("Expected no masking while disabled, got '%s'", lines[0])
+	}
+	if strings.Contains(lines[1], "sid1") {
+		t.Errorf("Expected masking while enabled, got '%s'", lines[1])
+	}
+}
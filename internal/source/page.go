@@ -0,0 +1,86 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/parse"
+)
+
+func init() {
+	Register(TypeSubscription, pageSource{userinfoFallback: true})
+	Register(TypeHTML, pageSource{})
+	Register(TypeUserinfo, userinfoSource{})
+	Register(TypeClash, clashSource{})
+}
+
+// pageSource reads the template#subscription-data node of a subscription page
+type pageSource struct {
+	// userinfoFallback parses the Subscription-Userinfo header when the body
+	// is not a subscription page (e.g. a base64 node list)
+	userinfoFallback bool
+}
+
+func (s pageSource) Fetch(ctx context.Context, t Target) (*fetch.Response, error) {
+	return t.Client.Get(ctx, t.URL)
+}
+
+func (s pageSource) Parse(t Target, resp *fetch.Response) ([]parse.ParsedSubscription, []string, error) {
+	parsed, err := parse.ParseSubscriptionOptions(resp.Body, t.Options)
+	if err != nil {
+		if !s.userinfoFallback || resp.Header.Get(parse.UserinfoHeader) == "" {
+			return nil, nil, err
+		}
+		return parseUserinfoHeader(t, resp)
+	}
+	return []parse.ParsedSubscription{parsed}, nil, nil
+}
+
+// userinfoSource reads the Subscription-Userinfo header and ignores the body
+type userinfoSource struct{}
+
+func (userinfoSource) Fetch(ctx context.Context, t Target) (*fetch.Response, error) {
+	return t.Client.GetWithHeaders(ctx, t.URL, nil)
+}
+
+func (userinfoSource) Parse(t Target, resp *fetch.Response) ([]parse.ParsedSubscription, []string, error) {
+	return parseUserinfoHeader(t, resp)
+}
+
+// clashUserAgent makes providers serve the Clash format with its Subscription-Userinfo header
+const clashUserAgent = "clash.meta"
+
+// clashSource reads a Clash YAML subscription; traffic data comes from the
+// Subscription-Userinfo header, the body is only checked to be a Clash config
+type clashSource struct{}
+
+func (clashSource) Fetch(ctx context.Context, t Target) (*fetch.Response, error) {
+	return t.Client.GetWithHeaders(ctx, t.URL, map[string]string{"User-Agent": clashUserAgent})
+}
+
+func (clashSource) Parse(t Target, resp *fetch.Response) ([]parse.ParsedSubscription, []string, error) {
+	if err := parse.ValidateClashConfig(resp.Body); err != nil {
+		return nil, nil, err
+	}
+	return parseUserinfoHeader(t, resp)
+}
+
+// parseUserinfoHeader parses the Subscription-Userinfo header using the SID derived from the target URL
+func parseUserinfoHeader(t Target, resp *fetch.Response) ([]parse.ParsedSubscription, []string, error) {
+	value := resp.Header.Get(parse.UserinfoHeader)
+	if value == "" {
+		return nil, nil, fmt.Errorf("%s header missing", parse.UserinfoHeader)
+	}
+
+	sid, err := parse.SIDFromURL(t.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := parse.ParseUserinfoOptions(value, sid, t.Options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s header: %w", parse.UserinfoHeader, err)
+	}
+	return []parse.ParsedSubscription{parsed}, nil, nil
+}
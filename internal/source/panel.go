@@ -0,0 +1,33 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/parse"
+)
+
+func init() {
+	Register(TypePanel, panelSource{})
+}
+
+// panelSource logs into a 3x-ui panel and reads every client of its inbounds
+type panelSource struct{}
+
+func (panelSource) Fetch(ctx context.Context, t Target) (*fetch.Response, error) {
+	return t.Client.GetPanelInbounds(ctx, t.URL, t.Panel)
+}
+
+func (panelSource) Parse(t Target, resp *fetch.Response) ([]parse.ParsedSubscription, []string, error) {
+	subscriptions, skipped, err := parse.ParsePanelInbounds(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	if skipped > 0 {
+		warnings = append(warnings, fmt.Sprintf("skipped %d client(s) without email", skipped))
+	}
+	return subscriptions, warnings, nil
+}
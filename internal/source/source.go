@@ -0,0 +1,100 @@
+// Package source turns a configured target into parsed subscriptions.
+// Each target type (subscription page, Subscription-Userinfo header, panel
+// API, Clash YAML, ...) is a Source registered under its type name.
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/methol/xui-exporter/internal/fetch"
+	"github.com/methol/xui-exporter/internal/parse"
+)
+
+// Built-in source types
+const (
+	// TypeSubscription is a /sub/<sid> page, parsed as HTML with a fallback
+	// to the Subscription-Userinfo header (the default)
+	TypeSubscription = "subscription"
+
+	// TypeHTML is a subscription page parsed as HTML only
+	TypeHTML = "html"
+
+	// TypeUserinfo is a raw subscription endpoint whose Subscription-Userinfo header is parsed
+	TypeUserinfo = "userinfo"
+
+	// TypeClash is a Clash YAML subscription with a Subscription-Userinfo header
+	TypeClash = "clash"
+
+	// TypePanel is a 3x-ui panel whose clients are enumerated via its API
+	TypePanel = "panel"
+)
+
+// Target is what a Source needs to fetch a configured target
+type Target struct {
+	URL    string
+	Client *fetch.Client
+
+	// Panel holds the login credentials of panel targets
+	Panel fetch.PanelCredentials
+
+	// Options relaxes the validation of parsed values
+	Options parse.Options
+}
+
+// Source fetches a target and parses the response into subscriptions.
+// Fetch and Parse are separate so that fetch errors and parse errors are
+// reported with different reasons, and so parsers can be tested on fixtures.
+type Source interface {
+	// Fetch retrieves the raw response of the target
+	Fetch(ctx context.Context, t Target) (*fetch.Response, error)
+
+	// Parse extracts the subscriptions from a response returned by Fetch.
+	// Warnings describe non-fatal problems, e.g. skipped entries, for the
+	// caller to log.
+	Parse(t Target, resp *fetch.Response) (subscriptions []parse.ParsedSubscription, warnings []string, err error)
+}
+
+var (
+	mu      sync.RWMutex
+	sources = make(map[string]Source)
+)
+
+// Register makes a Source available under the given type name.
+// It panics if the name is empty or already registered.
+func Register(name string, s Source) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		panic("source: Register with empty name")
+	}
+	if _, exists := sources[name]; exists {
+		panic(fmt.Sprintf("source: Register called twice for %q", name))
+	}
+	sources[name] = s
+}
+
+// Lookup returns the Source registered under name
+func Lookup(name string) (Source, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	s, ok := sources[name]
+	return s, ok
+}
+
+// Types returns the registered type names, sorted
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,138 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/methol/xui-exporter/internal/fetch"
+)
+
+const testPage = `<html><body><template id="subscription-data" data-sid="sid1" data-downloadbyte="100" data-uploadbyte="50" data-totalbyte="1000" data-expire="1700000000"></template></body></html>`
+
+const testUserinfo = "upload=5; download=10; total=2000; expire=1800000000"
+
+const testClash = "proxies:\n  - name: node-1\n    type: vless\n    server: example.com\n    port: 443\n"
+
+// newTestTarget starts a server with handler and returns a target for its /sub/sid2 path
+func newTestTarget(t *testing.T, handler http.HandlerFunc) Target {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := fetch.NewClient(fetch.Options{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return Target{URL: server.URL + "/sub/sid2", Client: client}
+}
+
+// run fetches and parses t with the source registered under name
+func run(t *testing.T, name string, target Target) (string, error) {
+	t.Helper()
+	src, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("Source %q not registered", name)
+	}
+
+	resp, err := src.Fetch(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	subscriptions, _, err := src.Parse(target, resp)
+	if err != nil {
+		return "", err
+	}
+	if len(subscriptions) != 1 {
+		t.Fatalf("Expected 1 subscription, got %d", len(subscriptions))
+	}
+	return subscriptions[0].SID, nil
+}
+
+func TestTypes(t *testing.T) {
+	for _, name := range []string{TypeSubscription, TypeHTML, TypeUserinfo, TypeClash, TypePanel} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("Expected source %q to be registered", name)
+		}
+	}
+
+	if got := len(Types()); got != 5 {
+		t.Errorf("Expected 5 types, got %d", got)
+	}
+}
+
+func TestRegister_DuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for duplicate registration")
+		}
+	}()
+	Register(TypeHTML, pageSource{})
+}
+
+func TestSubscriptionSource(t *testing.T) {
+	page := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testPage))
+	})
+	if sid, err := run(t, TypeSubscription, page); err != nil || sid != "sid1" {
+		t.Errorf("Expected sid 'sid1' from page, got '%s' (err: %v)", sid, err)
+	}
+
+	// Node lists fall back to the header, with the SID taken from the URL
+	nodes := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Subscription-Userinfo", testUserinfo)
+		w.Write([]byte("dmxlc3M6Ly8uLi4="))
+	})
+	if sid, err := run(t, TypeSubscription, nodes); err != nil || sid != "sid2" {
+		t.Errorf("Expected sid 'sid2' from header, got '%s' (err: %v)", sid, err)
+	}
+
+	// The html type does not fall back
+	if _, err := run(t, TypeHTML, nodes); err == nil {
+		t.Error("Expected html source to fail without a subscription page")
+	}
+}
+
+func TestUserinfoSource(t *testing.T) {
+	target := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Subscription-Userinfo", testUserinfo)
+		w.Write([]byte(testPage))
+	})
+
+	// The header wins even if the body is a subscription page
+	if sid, err := run(t, TypeUserinfo, target); err != nil || sid != "sid2" {
+		t.Errorf("Expected sid 'sid2', got '%s' (err: %v)", sid, err)
+	}
+
+	missing := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("nodes"))
+	})
+	if _, err := run(t, TypeUserinfo, missing); err == nil {
+		t.Error("Expected error when the header is missing")
+	}
+}
+
+func TestClashSource(t *testing.T) {
+	target := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != clashUserAgent {
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		w.Header().Set("Subscription-Userinfo", testUserinfo)
+		w.Write([]byte(testClash))
+	})
+	if sid, err := run(t, TypeClash, target); err != nil || sid != "sid2" {
+		t.Errorf("Expected sid 'sid2', got '%s' (err: %v)", sid, err)
+	}
+
+	// An error page with the header is rejected
+	errorPage := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Subscription-Userinfo", testUserinfo)
+		w.Write([]byte("<html><body>maintenance</body></html>"))
+	})
+	if _, err := run(t, TypeClash, errorPage); err == nil {
+		t.Error("Expected error for a non-Clash body")
+	}
+}
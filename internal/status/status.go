@@ -0,0 +1,316 @@
+// Package status renders the HTML status page listing every target and
+// subscription. Templates are embedded; the page needs no JavaScript.
+package status
+
+import (
+	"cmp"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+// Sort orders of the subscription table, selected with ?sort=
+const (
+	SortUrgency = "urgency"
+	SortTarget  = "target"
+	SortSID     = "sid"
+	SortExpiry  = "expiry"
+	SortUsage   = "usage"
+)
+
+// Handler serves the status page
+type Handler struct {
+	store       *store.Store
+	metricsPath string
+	targets     func() []string
+	tmpl        *template.Template
+}
+
+// NewHandler creates a Handler for the subscriptions in st.
+// metricsPath is linked from the page header. targets returns the labels of
+// the configured targets; those not refreshed yet are listed as pending.
+func NewHandler(st *store.Store, metricsPath string, targets func() []string) *Handler {
+	tmpl := template.Must(template.New("status.html").Funcs(template.FuncMap{
+		"bytes":    formatBytes,
+		"days":     formatDays,
+		"time":     formatTime,
+		"duration": formatDuration,
+	}).ParseFS(templates, "templates/status.html"))
+
+	return &Handler{
+		store:       st,
+		metricsPath: metricsPath,
+		targets:     targets,
+		tmpl:        tmpl,
+	}
+}
+
+// page is the data rendered by the status template
+type page struct {
+	Now           time.Time
+	MetricsPath   string
+	Sort          string
+	Targets       []targetRow
+	Subscriptions []subscriptionRow
+}
+
+// targetRow is a configured target and its last fetch result
+type targetRow struct {
+	store.TargetStatus
+	Subscriptions int
+	CertExpiry    time.Time
+
+	// Pending is true until the target has been refreshed once
+	Pending bool
+}
+
+// subscriptionRow is a subscription with its display values
+type subscriptionRow struct {
+	compute.SubscriptionMetrics
+
+	// State is "up", "stale" or "down"
+	State string
+
+	// Error is the failure reason while not up
+	Error string
+
+	// Labels are the extra labels as name=value pairs
+	Labels string
+
+	// daysLeft is the earlier of the days until expiry and until the projected
+	// quota exhaustion (+Inf if neither is known), the urgency sort key
+	daysLeft float64
+
+	// expiryDays is the days until expiry (+Inf if it never expires), the
+	// expiry sort key
+	expiryDays float64
+
+	// group orders rows by severity for the urgency sort
+	group int
+}
+
+// Severity groups of the urgency sort, most urgent first
+const (
+	groupDown = iota
+	groupExpired
+	groupExhausted
+	groupStale
+	groupUp
+)
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	switch sortBy {
+	case SortTarget, SortSID, SortExpiry, SortUsage:
+	default:
+		sortBy = SortUrgency
+	}
+
+	now := time.Now()
+	p := page{
+		Now:         now,
+		MetricsPath: h.metricsPath,
+		Sort:        sortBy,
+	}
+
+	reasons := make(map[string]string)
+	counts := make(map[string]int)
+	snapshot := h.store.GetSnapshot()
+	for _, m := range snapshot {
+		counts[m.Target]++
+	}
+
+	refreshed := make(map[string]bool)
+	for _, t := range h.store.GetTargets() {
+		row := targetRow{TargetStatus: t, Subscriptions: counts[t.Target]}
+		if t.TLSCertExpiryTimestampSeconds > 0 {
+			row.CertExpiry = time.Unix(int64(t.TLSCertExpiryTimestampSeconds), 0)
+		}
+		if !t.Up {
+			reasons[t.Target] = t.Reason
+		}
+		refreshed[t.Target] = true
+		p.Targets = append(p.Targets, row)
+	}
+
+	if h.targets != nil {
+		for _, label := range h.targets() {
+			if refreshed[label] {
+				continue
+			}
+			p.Targets = append(p.Targets, targetRow{
+				TargetStatus:  store.TargetStatus{Target: label},
+				Subscriptions: counts[label],
+				Pending:       true,
+			})
+		}
+		slices.SortFunc(p.Targets, func(a, b targetRow) int { return cmp.Compare(a.Target, b.Target) })
+	}
+
+	for _, m := range snapshot {
+		p.Subscriptions = append(p.Subscriptions, newSubscriptionRow(m, reasons[m.Target], now))
+	}
+	sortSubscriptions(p.Subscriptions, sortBy)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.tmpl.Execute(w, p); err != nil {
+		log.Printf("Failed to render status page: %v", err)
+	}
+}
+
+// newSubscriptionRow computes the display values of a subscription
+func newSubscriptionRow(m compute.SubscriptionMetrics, targetReason string, now time.Time) subscriptionRow {
+	row := subscriptionRow{
+		SubscriptionMetrics: m,
+		daysLeft:            math.Inf(1),
+		expiryDays:          math.Inf(1),
+	}
+
+	labels := m.AllLabels()
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+labels[name])
+	}
+	row.Labels = strings.Join(pairs, ", ")
+
+	switch {
+	case m.Up:
+		row.State = "up"
+	case m.Stale:
+		row.State = "stale"
+	default:
+		row.State = "down"
+	}
+	if !m.Up {
+		row.Error = targetReason
+		if row.Error == "" && !m.Stale {
+			row.Error = store.ReasonValidation
+		}
+	}
+
+	if !m.NoExpiry {
+		row.expiryDays = m.DaysUntilExpire
+	}
+	row.daysLeft = row.expiryDays
+	if m.ProjectedExhaustionTimestampSeconds > 0 {
+		exhaustion := (m.ProjectedExhaustionTimestampSeconds - float64(now.Unix())) / 86400
+		row.daysLeft = math.Min(row.daysLeft, exhaustion)
+	}
+
+	switch {
+	case row.State == "down":
+		row.group = groupDown
+	case m.Expired == 1:
+		row.group = groupExpired
+	case !m.UnlimitedQuota && m.RemainingBytes <= 0:
+		row.group = groupExhausted
+	case row.State == "stale":
+		row.group = groupStale
+	default:
+		row.group = groupUp
+	}
+
+	return row
+}
+
+// sortSubscriptions orders rows by the given sort order, then by target and SID
+func sortSubscriptions(rows []subscriptionRow, sortBy string) {
+	slices.SortStableFunc(rows, func(a, b subscriptionRow) int {
+		var c int
+		switch sortBy {
+		case SortUrgency:
+			c = cmp.Or(
+				cmp.Compare(a.group, b.group),
+				cmp.Compare(a.daysLeft, b.daysLeft),
+				cmp.Compare(b.UsedRatio, a.UsedRatio),
+			)
+		case SortExpiry:
+			c = cmp.Compare(a.expiryDays, b.expiryDays)
+		case SortUsage:
+			c = cmp.Compare(b.UsedRatio, a.UsedRatio)
+		case SortSID:
+			c = cmp.Compare(a.SID, b.SID)
+		}
+		return cmp.Or(c, cmp.Compare(a.Target, b.Target), cmp.Compare(a.SID, b.SID), cmp.Compare(a.Labels, b.Labels))
+	})
+}
+
+// formatBytes formats a byte count with binary units
+func formatBytes(v interface{}) string {
+	var b float64
+	switch n := v.(type) {
+	case int64:
+		b = float64(n)
+	case float64:
+		b = n
+	}
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for math.Abs(b) >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", b, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", b, units[i])
+}
+
+// formatDays formats a number of days ("∞" when unknown)
+func formatDays(d float64) string {
+	if math.IsInf(d, 1) {
+		return "∞"
+	}
+	return fmt.Sprintf("%.1f", d)
+}
+
+// formatTime formats Unix seconds or a time ("never" for zero values)
+func formatTime(v interface{}) string {
+	var t time.Time
+	switch x := v.(type) {
+	case float64:
+		if x > 0 {
+			t = time.Unix(int64(x), 0)
+		}
+	case int64:
+		if x > 0 {
+			t = time.Unix(x, 0)
+		}
+	case time.Time:
+		t = x
+	}
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// formatDuration formats seconds as a rounded duration
+func formatDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
@@ -0,0 +1,142 @@
+package status
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+	"github.com/methol/xui-exporter/internal/store"
+)
+
+func TestServeHTTP(t *testing.T) {
+	now := float64(time.Now().Unix())
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "alice", Up: true, UsedBytes: 512, QuotaBytes: 1024, UsedRatio: 0.5, DaysUntilExpire: 10, LastSuccessTimestampSeconds: now},
+		"sid2": {SID: "sid2", Target: "bob", Up: false},
+	}, []store.TargetStatus{
+		{Target: "alice", Up: true},
+		{Target: "bob", Up: false, Reason: store.ReasonNetwork},
+	})
+
+	rec := httptest.NewRecorder()
+	NewHandler(st, "/metrics", nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{"alice", "bob", "down (network)", "512 B / 1.00 KiB", `href="/metrics"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+
+	if strings.Contains(body, "/probe") {
+		t.Error("Expected no link to /probe, which needs a target")
+	}
+
+	// Urgency order: the failed subscription comes first
+	if strings.Index(body, "<td>sid2</td>") > strings.Index(body, "<td>sid1</td>") {
+		t.Error("Expected sid2 (down) to be listed before sid1")
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(st, "/metrics", nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for other paths, got %d", rec.Code)
+	}
+}
+
+func TestServeHTTP_PendingTargets(t *testing.T) {
+	st := store.New()
+	st.SetSnapshot(nil, []store.TargetStatus{{Target: "alice", Up: true}})
+
+	targets := func() []string { return []string{"alice", "bob"} }
+	rec := httptest.NewRecorder()
+	NewHandler(st, "/metrics", targets).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "<td>bob</td>\n<td class=\"muted\">pending</td>") {
+		t.Errorf("Expected bob to be listed as pending, got:\n%s", body)
+	}
+	if strings.Contains(body, "<td>alice</td>\n<td class=\"muted\">pending</td>") {
+		t.Error("Expected refreshed target alice not to be pending")
+	}
+}
+
+func TestSortSubscriptions_Urgency(t *testing.T) {
+	now := time.Now()
+	rows := []subscriptionRow{
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "healthy", Up: true, RemainingBytes: 10, DaysUntilExpire: 30}, "", now),
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "soon", Up: true, RemainingBytes: 10, DaysUntilExpire: 2}, "", now),
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "expired", Up: true, RemainingBytes: 10, Expired: 1}, "", now),
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "exhausted", Up: true, RemainingBytes: 0, DaysUntilExpire: 30}, "", now),
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "down"}, store.ReasonTimeout, now),
+	}
+
+	sortSubscriptions(rows, SortUrgency)
+
+	want := []string{"down", "expired", "exhausted", "soon", "healthy"}
+	for i, row := range rows {
+		if row.SID != want[i] {
+			t.Errorf("Position %d: expected %s, got %s", i, want[i], row.SID)
+		}
+	}
+}
+
+func TestServeHTTP_DaysUntilExpiry(t *testing.T) {
+	st := store.New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "alice", Up: true, QuotaBytes: 1024, RemainingBytes: 512, DaysUntilExpire: 20},
+		"sid2": {SID: "sid2", Target: "alice", Up: true, QuotaBytes: 1024, RemainingBytes: 512, NoExpiry: true},
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	NewHandler(st, "/metrics", nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{"Days until expiry", `<td class="num">20.0</td>`, `<td class="num"><span class="muted">-</span></td>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestSortSubscriptions_ProjectedExhaustion(t *testing.T) {
+	now := time.Now()
+	exhaustion := float64(now.Add(48 * time.Hour).Unix())
+	rows := []subscriptionRow{
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "expiring", Up: true, RemainingBytes: 10, DaysUntilExpire: 10}, "", now),
+		newSubscriptionRow(compute.SubscriptionMetrics{SID: "exhausting", Up: true, RemainingBytes: 10, DaysUntilExpire: 20, ProjectedExhaustionTimestampSeconds: exhaustion}, "", now),
+	}
+
+	// Urgency ranks by the projected exhaustion as well, the expiry sort does not
+	sortSubscriptions(rows, SortUrgency)
+	if rows[0].SID != "exhausting" {
+		t.Errorf("Expected exhausting first by urgency, got %s", rows[0].SID)
+	}
+
+	sortSubscriptions(rows, SortExpiry)
+	if rows[0].SID != "expiring" {
+		t.Errorf("Expected expiring first by expiry, got %s", rows[0].SID)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1536:          "1.50 KiB",
+		5 * (1 << 30): "5.00 GiB",
+	}
+	for in, want := range tests {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d): expected %s, got %s", in, want, got)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+)
+
+// StateVersion is the current on-disk state format version.
+// Bump it on incompatible changes; files with another version are ignored.
+const StateVersion = 1
+
+// state is the on-disk representation of the store
+type state struct {
+	Version       int                 `json:"version"`
+	SavedAt       time.Time           `json:"saved_at"`
+	Subscriptions []subscriptionState `json:"subscriptions"`
+
+	// History holds the used bytes samples by subscription key; older files
+	// without it restore with an empty history
+	History map[string][]compute.UsageSample `json:"history,omitempty"`
+
+	// Privacy is the fingerprint of the privacy settings the SIDs were
+	// produced with (empty for raw SIDs)
+	Privacy string `json:"privacy,omitempty"`
+}
+
+// subscriptionState is the on-disk representation of a subscription.
+// It mirrors compute.SubscriptionMetrics with stable field names, so that
+// renaming a Go field does not silently drop it from older state files.
+type subscriptionState struct {
+	SID          string            `json:"sid"`
+	Target       string            `json:"target,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	TargetLabels map[string]string `json:"target_labels,omitempty"`
+	Info         compute.Info      `json:"info"`
+
+	Up             bool `json:"up"`
+	Stale          bool `json:"stale"`
+	UnlimitedQuota bool `json:"unlimited_quota,omitempty"`
+	NoExpiry       bool `json:"no_expiry,omitempty"`
+
+	DownloadBytes          int64 `json:"download_bytes"`
+	UploadBytes            int64 `json:"upload_bytes"`
+	QuotaBytes             int64 `json:"quota_bytes"`
+	ExpireTimestampSeconds int64 `json:"expire_timestamp_seconds"`
+
+	UsedBytes          int64   `json:"used_bytes"`
+	RemainingBytes     int64   `json:"remaining_bytes"`
+	UsedRatio          float64 `json:"used_ratio"`
+	RemainingRatio     float64 `json:"remaining_ratio"`
+	SecondsUntilExpire int64   `json:"seconds_until_expire"`
+	DaysUntilExpire    float64 `json:"days_until_expire"`
+	Expired            int64   `json:"expired"`
+	DailyBudgetBytes   float64 `json:"daily_budget_bytes"`
+
+	UsageRates                          []usageRateState `json:"usage_rates,omitempty"`
+	ProjectedExhaustionTimestampSeconds float64          `json:"projected_exhaustion_timestamp_seconds,omitempty"`
+	WillExhaustBeforeExpiry             int64            `json:"will_exhaust_before_expiry,omitempty"`
+
+	Resets              int64 `json:"resets"`
+	DownloadOffsetBytes int64 `json:"download_offset_bytes"`
+	UploadOffsetBytes   int64 `json:"upload_offset_bytes"`
+
+	LastRefreshTimestampSeconds float64 `json:"last_refresh_timestamp_seconds"`
+	RefreshDurationSeconds      float64 `json:"refresh_duration_seconds"`
+	LastSuccessTimestampSeconds float64 `json:"last_success_timestamp_seconds"`
+}
+
+// usageRateState is the on-disk representation of a compute.UsageRate
+type usageRateState struct {
+	WindowSeconds  float64 `json:"window_seconds"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+func newSubscriptionState(m compute.SubscriptionMetrics) subscriptionState {
+	sub := subscriptionState{
+		SID:                                 m.SID,
+		Target:                              m.Target,
+		Labels:                              m.Labels,
+		TargetLabels:                        m.TargetLabels,
+		Info:                                m.Info,
+		Up:                                  m.Up,
+		Stale:                               m.Stale,
+		UnlimitedQuota:                      m.UnlimitedQuota,
+		NoExpiry:                            m.NoExpiry,
+		DownloadBytes:                       m.DownloadBytes,
+		UploadBytes:                         m.UploadBytes,
+		QuotaBytes:                          m.QuotaBytes,
+		ExpireTimestampSeconds:              m.ExpireTimestampSeconds,
+		UsedBytes:                           m.UsedBytes,
+		RemainingBytes:                      m.RemainingBytes,
+		UsedRatio:                           m.UsedRatio,
+		RemainingRatio:                      m.RemainingRatio,
+		SecondsUntilExpire:                  m.SecondsUntilExpire,
+		DaysUntilExpire:                     m.DaysUntilExpire,
+		Expired:                             m.Expired,
+		DailyBudgetBytes:                    m.DailyBudgetBytes,
+		ProjectedExhaustionTimestampSeconds: m.ProjectedExhaustionTimestampSeconds,
+		WillExhaustBeforeExpiry:             m.WillExhaustBeforeExpiry,
+		Resets:                              m.Resets,
+		DownloadOffsetBytes:                 m.DownloadOffsetBytes,
+		UploadOffsetBytes:                   m.UploadOffsetBytes,
+		LastRefreshTimestampSeconds:         m.LastRefreshTimestampSeconds,
+		RefreshDurationSeconds:              m.RefreshDurationSeconds,
+		LastSuccessTimestampSeconds:         m.LastSuccessTimestampSeconds,
+	}
+	for _, rate := range m.UsageRates {
+		sub.UsageRates = append(sub.UsageRates, usageRateState{
+			WindowSeconds:  rate.Window.Seconds(),
+			BytesPerSecond: rate.BytesPerSecond,
+		})
+	}
+	return sub
+}
+
+func (sub subscriptionState) metrics() compute.SubscriptionMetrics {
+	m := compute.SubscriptionMetrics{
+		SID:                                 sub.SID,
+		Target:                              sub.Target,
+		Labels:                              sub.Labels,
+		TargetLabels:                        sub.TargetLabels,
+		Info:                                sub.Info,
+		Up:                                  sub.Up,
+		Stale:                               sub.Stale,
+		UnlimitedQuota:                      sub.UnlimitedQuota,
+		NoExpiry:                            sub.NoExpiry,
+		DownloadBytes:                       sub.DownloadBytes,
+		UploadBytes:                         sub.UploadBytes,
+		QuotaBytes:                          sub.QuotaBytes,
+		ExpireTimestampSeconds:              sub.ExpireTimestampSeconds,
+		UsedBytes:                           sub.UsedBytes,
+		RemainingBytes:                      sub.RemainingBytes,
+		UsedRatio:                           sub.UsedRatio,
+		RemainingRatio:                      sub.RemainingRatio,
+		SecondsUntilExpire:                  sub.SecondsUntilExpire,
+		DaysUntilExpire:                     sub.DaysUntilExpire,
+		Expired:                             sub.Expired,
+		DailyBudgetBytes:                    sub.DailyBudgetBytes,
+		ProjectedExhaustionTimestampSeconds: sub.ProjectedExhaustionTimestampSeconds,
+		WillExhaustBeforeExpiry:             sub.WillExhaustBeforeExpiry,
+		Resets:                              sub.Resets,
+		DownloadOffsetBytes:                 sub.DownloadOffsetBytes,
+		UploadOffsetBytes:                   sub.UploadOffsetBytes,
+		LastRefreshTimestampSeconds:         sub.LastRefreshTimestampSeconds,
+		RefreshDurationSeconds:              sub.RefreshDurationSeconds,
+		LastSuccessTimestampSeconds:         sub.LastSuccessTimestampSeconds,
+	}
+	for _, rate := range sub.UsageRates {
+		m.UsageRates = append(m.UsageRates, compute.UsageRate{
+			Window:         time.Duration(rate.WindowSeconds * float64(time.Second)),
+			BytesPerSecond: rate.BytesPerSecond,
+		})
+	}
+	return m
+}
+
+// SaveFile writes the current snapshot to path atomically
+// (write to a temporary file in the same directory, then rename).
+// Concurrent calls are serialized, so the last call leaves the newest snapshot.
+func (s *Store) SaveFile(path string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.RLock()
+	st := state{
+		Version:       StateVersion,
+		SavedAt:       time.Now(),
+		Subscriptions: make([]subscriptionState, 0, len(s.snapshot)),
+		History:       make(map[string][]compute.UsageSample, len(s.history)),
+		Privacy:       s.privacy,
+	}
+	for _, m := range s.snapshot {
+		st.Subscriptions = append(st.Subscriptions, newSubscriptionState(m))
+	}
+	for key, samples := range s.history {
+		st.History[key] = append([]compute.UsageSample(nil), samples...)
+	}
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadFile restores the snapshot from path. Restored entries are marked
+// down and stale until a refresh replaces them. A missing file is not an
+// error; a file saved with another privacy fingerprint is (see
+// SetPrivacyFingerprint), and nothing is restored from it.
+// Returns the number of restored subscriptions.
+func (s *Store) LoadFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return 0, fmt.Errorf("failed to decode state file: %w", err)
+	}
+
+	if st.Version != StateVersion {
+		return 0, fmt.Errorf("unsupported state file version %d (expected %d)", st.Version, StateVersion)
+	}
+
+	// SIDs produced under other privacy settings would be exported as is,
+	// e.g. raw SIDs after privacy mode was enabled
+	s.mu.RLock()
+	privacy := s.privacy
+	s.mu.RUnlock()
+	if st.Privacy != privacy {
+		return 0, fmt.Errorf("state file was saved with other privacy settings, not restoring its subscriptions")
+	}
+
+	snapshot := make(map[string]compute.SubscriptionMetrics, len(st.Subscriptions))
+	for _, sub := range st.Subscriptions {
+		m := sub.metrics()
+		// Failed entries carry no values worth restoring
+		if !m.Up && !m.Stale {
+			continue
+		}
+		m.Up = false
+		m.Stale = true
+		snapshot[m.Key()] = m
+	}
+
+	history := make(map[string][]compute.UsageSample, len(st.History))
+	for key, samples := range st.History {
+		if _, ok := snapshot[key]; ok {
+			history[key] = samples
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	s.history = history
+
+	return len(snapshot), nil
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+)
+
+func TestSaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	src := New()
+	src.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "alice", Up: true, DownloadBytes: 100, QuotaBytes: 1000},
+	}, nil)
+
+	if err := src.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	dst := New()
+	n, err := dst.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 restored subscription, got %d", n)
+	}
+
+	m := dst.GetSnapshot()["sid1"]
+	if m.DownloadBytes != 100 || m.QuotaBytes != 1000 || m.Target != "alice" {
+		t.Errorf("Restored entry does not match saved entry: %+v", m)
+	}
+
+	if !m.Stale {
+		t.Error("Expected restored entry to be stale")
+	}
+
+	if m.Up {
+		t.Error("Expected restored entry to be down until refreshed")
+	}
+}
+
+func TestSubscriptionState_RoundTrip(t *testing.T) {
+	m := compute.SubscriptionMetrics{
+		SID:                                 "sid1",
+		Target:                              "panel-1",
+		Labels:                              map[string]string{"email": "alice"},
+		TargetLabels:                        map[string]string{"owner": "alice"},
+		Info:                                compute.Info{Remark: "main", SourceTarget: "panel-1"},
+		Up:                                  true,
+		Stale:                               true,
+		UnlimitedQuota:                      true,
+		NoExpiry:                            true,
+		DownloadBytes:                       1,
+		UploadBytes:                         2,
+		QuotaBytes:                          3,
+		ExpireTimestampSeconds:              4,
+		UsedBytes:                           5,
+		RemainingBytes:                      6,
+		UsedRatio:                           0.7,
+		RemainingRatio:                      0.8,
+		SecondsUntilExpire:                  9,
+		DaysUntilExpire:                     10.5,
+		Expired:                             1,
+		DailyBudgetBytes:                    11.5,
+		UsageRates:                          []compute.UsageRate{{Window: time.Hour, BytesPerSecond: 12.5}},
+		ProjectedExhaustionTimestampSeconds: 13,
+		WillExhaustBeforeExpiry:             1,
+		Resets:                              14,
+		DownloadOffsetBytes:                 15,
+		UploadOffsetBytes:                   16,
+		LastRefreshTimestampSeconds:         17,
+		RefreshDurationSeconds:              18,
+		LastSuccessTimestampSeconds:         19,
+	}
+
+	// Every field is set, so a field added to SubscriptionMetrics but not to
+	// subscriptionState fails the comparison below
+	v := reflect.ValueOf(m)
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			t.Fatalf("Expected the test entry to set %s", v.Type().Field(i).Name)
+		}
+	}
+
+	data, err := json.Marshal(newSubscriptionState(m))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	for _, key := range []string{`"sid":`, `"download_offset_bytes":`, `"window_seconds":3600`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("Expected the encoded entry to contain %s, got %s", key, data)
+		}
+	}
+
+	var sub subscriptionState
+	if err := json.Unmarshal(data, &sub); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := sub.metrics(); !reflect.DeepEqual(got, m) {
+		t.Errorf("Expected %+v, got %+v", m, got)
+	}
+}
+
+func TestLoadFile_Missing(t *testing.T) {
+	n, err := New().LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || n != 0 {
+		t.Errorf("Expected (0, nil) for missing file, got (%d, %v)", n, err)
+	}
+}
+
+func TestLoadFile_WrongVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version": 999, "subscriptions": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New().LoadFile(path); err == nil {
+		t.Fatal("Expected error for unsupported version, got nil")
+	}
+}
+
+func TestSaveFile_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s := New()
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sid := fmt.Sprintf("sid%d", i)
+			s.UpdateTarget(map[string]compute.SubscriptionMetrics{
+				sid: {SID: sid, Target: sid, Up: true, QuotaBytes: 1000},
+			}, TargetStatus{Target: sid, Up: true})
+			if err := s.SaveFile(path); err != nil {
+				t.Errorf("SaveFile failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The last save to finish holds every update
+	n, err := New().LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if n != 10 {
+		t.Errorf("Expected 10 restored subscriptions, got %d", n)
+	}
+}
+
+func TestLoadFile_PrivacyMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	src := New()
+	src.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"rawsid": {SID: "rawsid", Target: "alice", Up: true, QuotaBytes: 1000},
+	}, nil)
+	if err := src.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	// Privacy mode enabled since the file was saved with raw SIDs
+	dst := New()
+	dst.SetPrivacyFingerprint("hmac-sha256:0123456789abcdef")
+	n, err := dst.LoadFile(path)
+	if err == nil {
+		t.Error("Expected error for a privacy fingerprint mismatch, got nil")
+	}
+	if n != 0 || len(dst.GetSnapshot()) != 0 {
+		t.Errorf("Expected nothing restored, got %d subscription(s)", len(dst.GetSnapshot()))
+	}
+
+	// Matching fingerprints restore as usual
+	src.SetPrivacyFingerprint("hmac-sha256:0123456789abcdef")
+	if err := src.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if n, err := dst.LoadFile(path); err != nil || n != 1 {
+		t.Errorf("Expected (1, nil) with matching fingerprints, got (%d, %v)", n, err)
+	}
+}
@@ -1,22 +1,80 @@
 package store
 
 import (
+	"cmp"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/methol/xui-exporter/internal/compute"
 )
 
+// Failure reasons reported in TargetStatus.Reason
+const (
+	ReasonNetwork    = "network"
+	ReasonTimeout    = "timeout"
+	ReasonHTTPStatus = "http_status"
+	ReasonParse      = "parse"
+	ReasonValidation = "validation"
+	ReasonAuth       = "auth"
+)
+
+// TargetStatus describes the outcome of the last refresh attempt for a configured target.
+// It is recorded for every target, including failures where the SID is unknown.
+type TargetStatus struct {
+	// Target is the label value identifying the target (possibly redacted)
+	Target string
+
+	// Labels are the static labels configured for the target
+	Labels map[string]string
+
+	// Up is true when fetch, parse and validation all succeeded
+	Up bool
+
+	// Reason is one of the Reason* constants when Up is false
+	Reason string
+
+	LastRefreshTimestampSeconds float64
+	RefreshDurationSeconds      float64
+
+	// RefreshInterval is how often the target is refreshed. The grace period
+	// of its subscriptions counts from the first missed refresh, so it is
+	// extended by one interval.
+	RefreshInterval time.Duration
+
+	// TLSCertExpiryTimestampSeconds is the NotAfter of the server's leaf
+	// certificate seen by the last fetch, including one that failed
+	// verification (0 if unknown or plain HTTP). UpdateTarget keeps the last
+	// known value when a failed refresh did not see the certificate.
+	TLSCertExpiryTimestampSeconds float64
+}
+
 // Store holds the current snapshot of subscription metrics
 // It provides thread-safe atomic snapshot replacement
 type Store struct {
-	mu       sync.RWMutex
-	snapshot map[string]compute.SubscriptionMetrics
+	mu          sync.RWMutex
+	snapshot    map[string]compute.SubscriptionMetrics
+	targets     []TargetStatus
+	gracePeriod time.Duration
+
+	// history holds the used bytes samples of each subscription, covering
+	// the longest usage window
+	history      map[string][]compute.UsageSample
+	usageWindows []time.Duration
+
+	// privacy is the fingerprint of the privacy settings the SIDs were
+	// produced with, saved in and checked against the state file
+	privacy string
+
+	// saveMu serializes SaveFile, so an older snapshot never replaces a newer one
+	saveMu sync.Mutex
 }
 
 // New creates a new Store with an empty snapshot
 func New() *Store {
 	return &Store{
 		snapshot: make(map[string]compute.SubscriptionMetrics),
+		history:  make(map[string][]compute.UsageSample),
 	}
 }
 
@@ -34,11 +92,239 @@ func (s *Store) GetSnapshot() map[string]compute.SubscriptionMetrics {
 	return snapshot
 }
 
-// SetSnapshot atomically replaces the entire snapshot
-// This is called after a full refresh cycle completes
-func (s *Store) SetSnapshot(newSnapshot map[string]compute.SubscriptionMetrics) {
+// GetTargets returns a copy of the latest status of every target
+func (s *Store) GetTargets() []TargetStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	targets := make([]TargetStatus, len(s.targets))
+	copy(targets, s.targets)
+	return targets
+}
+
+// SetGracePeriod sets how long the last successful values of a subscription
+// are carried forward (marked stale) after its refresh fails. 0 disables it.
+func (s *Store) SetGracePeriod(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gracePeriod = d
+}
+
+// SetUsageWindows sets the windows over which usage rates are computed.
+// The history kept per subscription covers the longest window.
+func (s *Store) SetUsageWindows(windows []time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.usageWindows = append([]time.Duration(nil), windows...)
+	slices.Sort(s.usageWindows)
+}
+
+// SetSnapshot atomically replaces the entire snapshot and target statuses
+// Subscriptions that are missing or down in newSnapshot keep their last
+// successful values, marked stale, while within the grace period.
+// Fresh subscriptions inherit the traffic reset counters of their previous
+// values, are added to the usage history and get their usage rates computed
+// from it.
+func (s *Store) SetSnapshot(newSnapshot map[string]compute.SubscriptionMetrics, targets []TargetStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intervals := make(map[string]time.Duration, len(targets))
+	for _, t := range targets {
+		intervals[t.Target] = t.RefreshInterval
+	}
+	s.merge(s.snapshot, newSnapshot, intervals)
+	for sid := range s.history {
+		if _, ok := newSnapshot[sid]; !ok {
+			delete(s.history, sid)
+		}
+	}
+
 	s.snapshot = newSnapshot
+	s.targets = targets
+}
+
+// UpdateTarget replaces the subscriptions and status of a single target,
+// leaving the other targets untouched. subscriptions holds the results of the
+// target's latest refresh and is merged like in SetSnapshot. A failed
+// refresh that did not see the certificate keeps its last known expiry.
+// Returns the keys that previously belonged to another target (last write wins).
+func (s *Store) UpdateTarget(subscriptions map[string]compute.SubscriptionMetrics, status TargetStatus) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := make(map[string]compute.SubscriptionMetrics)
+	var taken []string
+	for key, m := range s.snapshot {
+		if m.Target == status.Target {
+			prev[key] = m
+		} else if _, ok := subscriptions[key]; ok {
+			taken = append(taken, key)
+		}
+	}
+
+	s.merge(prev, subscriptions, map[string]time.Duration{status.Target: status.RefreshInterval})
+	for key := range prev {
+		if _, ok := subscriptions[key]; !ok {
+			delete(s.snapshot, key)
+			delete(s.history, key)
+		}
+	}
+	for key, m := range subscriptions {
+		s.snapshot[key] = m
+	}
+
+	i := slices.IndexFunc(s.targets, func(t TargetStatus) bool { return t.Target == status.Target })
+	if i < 0 {
+		s.targets = append(s.targets, status)
+	} else {
+		if !status.Up && status.TLSCertExpiryTimestampSeconds == 0 {
+			status.TLSCertExpiryTimestampSeconds = s.targets[i].TLSCertExpiryTimestampSeconds
+		}
+		s.targets[i] = status
+	}
+	slices.SortStableFunc(s.targets, func(a, b TargetStatus) int { return cmp.Compare(a.Target, b.Target) })
+
+	return taken
+}
+
+// merge carries the subscriptions of prev that are missing or down in next
+// forward into next, and applies the reset counters and usage history to the
+// fresh subscriptions of next. intervals holds the refresh interval by target.
+func (s *Store) merge(prev, next map[string]compute.SubscriptionMetrics, intervals map[string]time.Duration) {
+	now := time.Now()
+	for sid, p := range prev {
+		if n, ok := next[sid]; ok && n.Up {
+			continue
+		}
+		if carried, ok := s.carryForward(now, p, next[sid], intervals[p.Target]); ok {
+			next[sid] = carried
+		}
+	}
+
+	for sid, m := range next {
+		if !m.Up {
+			continue
+		}
+		if p, ok := s.snapshot[sid]; ok && p.LastSuccessTimestampSeconds > 0 {
+			compute.ApplyCounters(&m, &p)
+		}
+		s.history[sid] = s.recordUsage(s.history[sid], m)
+		compute.ApplyUsage(&m, s.history[sid], s.usageWindows)
+		next[sid] = m
+	}
+}
+
+// carryForward returns prev as a stale entry if it holds values that are
+// still within the grace period, counted from the first missed refresh:
+// interval after the last success. failed is the (possibly zero) entry of the
+// failed attempt, whose troubleshooting fields are kept.
+func (s *Store) carryForward(now time.Time, prev, failed compute.SubscriptionMetrics, interval time.Duration) (compute.SubscriptionMetrics, bool) {
+	if s.gracePeriod <= 0 || prev.LastSuccessTimestampSeconds == 0 {
+		return compute.SubscriptionMetrics{}, false
+	}
+
+	age := time.Duration((float64(now.Unix()) - prev.LastSuccessTimestampSeconds) * float64(time.Second))
+	if age > s.gracePeriod+interval {
+		return compute.SubscriptionMetrics{}, false
+	}
+
+	carried := prev
+	carried.Up = false
+	carried.Stale = true
+	if failed.SID != "" {
+		carried.LastRefreshTimestampSeconds = failed.LastRefreshTimestampSeconds
+		carried.RefreshDurationSeconds = failed.RefreshDurationSeconds
+	}
+	return carried, true
+}
+
+// recordUsage appends the used bytes of m, accumulated across traffic
+// resets, to history and drops samples older than the longest usage window.
+// A decrease (counters lost, e.g. the subscription came back after the grace
+// period) restarts the history, so rates never go negative.
+func (s *Store) recordUsage(history []compute.UsageSample, m compute.SubscriptionMetrics) []compute.UsageSample {
+	if len(s.usageWindows) == 0 {
+		return nil
+	}
+
+	sample := compute.UsageSample{
+		TimestampSeconds: m.LastSuccessTimestampSeconds,
+		UsedBytes:        m.DownloadBytesTotal() + m.UploadBytesTotal(),
+	}
+
+	if n := len(history); n > 0 {
+		switch {
+		case sample.UsedBytes < history[n-1].UsedBytes:
+			history = nil
+		case sample.TimestampSeconds <= history[n-1].TimestampSeconds:
+			history = history[:n-1]
+		}
+	}
+	history = append(history, sample)
+
+	cutoff := sample.TimestampSeconds - s.usageWindows[len(s.usageWindows)-1].Seconds()
+	i := 0
+	for i < len(history)-1 && history[i].TimestampSeconds < cutoff {
+		i++
+	}
+	return history[i:]
+}
+
+// SetPrivacyFingerprint sets the fingerprint of the privacy settings the
+// SIDs in the store are produced with (see config.PrivacyConfig.Fingerprint)
+func (s *Store) SetPrivacyFingerprint(fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.privacy = fingerprint
+}
+
+// DropSubscriptions drops the subscriptions of the given targets, and their
+// usage history, while keeping the target statuses. Used when the SIDs of the
+// targets change, e.g. after the privacy settings changed.
+// Returns the number of subscriptions dropped.
+func (s *Store) DropSubscriptions(targets map[string]bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped := 0
+	for key, m := range s.snapshot {
+		if targets[m.Target] {
+			delete(s.snapshot, key)
+			delete(s.history, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// RetainTargets drops subscriptions and target statuses whose target label is
+// not in keep. Used after a configuration reload removes targets.
+// Returns the number of subscriptions dropped.
+func (s *Store) RetainTargets(keep map[string]bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]compute.SubscriptionMetrics, len(s.snapshot))
+	for sid, m := range s.snapshot {
+		if keep[m.Target] {
+			snapshot[sid] = m
+		} else {
+			delete(s.history, sid)
+		}
+	}
+	removed := len(s.snapshot) - len(snapshot)
+
+	targets := make([]TargetStatus, 0, len(s.targets))
+	for _, t := range s.targets {
+		if keep[t.Target] {
+			targets = append(targets, t)
+		}
+	}
+
+	s.snapshot = snapshot
+	s.targets = targets
+	return removed
 }
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/methol/xui-exporter/internal/compute"
+)
+
+func TestSetSnapshot_CarriesForwardWithinGrace(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	st := New()
+	st.SetGracePeriod(5 * time.Minute)
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"fresh":   {SID: "fresh", Up: true, DownloadBytes: 100, LastSuccessTimestampSeconds: now},
+		"failed":  {SID: "failed", Up: true, DownloadBytes: 200, LastSuccessTimestampSeconds: now},
+		"expired": {SID: "expired", Up: true, DownloadBytes: 300, LastSuccessTimestampSeconds: now - 600},
+	}, nil)
+
+	// "fresh" disappears (target fetch failed), "failed" is down (validation failed)
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"failed": {SID: "failed", Up: false, LastRefreshTimestampSeconds: now + 1},
+	}, nil)
+
+	snapshot := st.GetSnapshot()
+
+	fresh, ok := snapshot["fresh"]
+	if !ok || !fresh.Stale || fresh.Up || fresh.DownloadBytes != 100 {
+		t.Errorf("Expected 'fresh' to be carried forward as stale, got %+v (present=%v)", fresh, ok)
+	}
+
+	failed := snapshot["failed"]
+	if !failed.Stale || failed.DownloadBytes != 200 {
+		t.Errorf("Expected 'failed' to keep last-good values as stale, got %+v", failed)
+	}
+	if failed.LastRefreshTimestampSeconds != now+1 {
+		t.Errorf("Expected 'failed' to keep the failed attempt's refresh timestamp, got %f", failed.LastRefreshTimestampSeconds)
+	}
+
+	if _, ok := snapshot["expired"]; ok {
+		t.Error("Expected 'expired' to be dropped after the grace period")
+	}
+}
+
+func TestSetSnapshot_GraceDisabled(t *testing.T) {
+	st := New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Up: true, LastSuccessTimestampSeconds: float64(time.Now().Unix())},
+	}, nil)
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{}, nil)
+
+	if len(st.GetSnapshot()) != 0 {
+		t.Error("Expected no carry-forward without a grace period")
+	}
+}
+
+func TestRetainTargets(t *testing.T) {
+	st := New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "keep"},
+		"sid2": {SID: "sid2", Target: "drop"},
+	}, []TargetStatus{{Target: "keep"}, {Target: "drop"}})
+
+	removed := st.RetainTargets(map[string]bool{"keep": true})
+	if removed != 1 {
+		t.Errorf("Expected 1 removed subscription, got %d", removed)
+	}
+
+	if _, ok := st.GetSnapshot()["sid1"]; !ok {
+		t.Error("Expected sid1 to be kept")
+	}
+
+	if targets := st.GetTargets(); len(targets) != 1 || targets[0].Target != "keep" {
+		t.Errorf("Expected only target 'keep', got %+v", targets)
+	}
+}
+
+func TestSetSnapshot_UsageHistory(t *testing.T) {
+	st := New()
+	st.SetUsageWindows([]time.Duration{time.Hour})
+
+	set := func(ts float64, download int64) compute.SubscriptionMetrics {
+		st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+			"sid1": {SID: "sid1", Up: true, DownloadBytes: download, UsedBytes: download, RemainingBytes: 1 << 30, LastSuccessTimestampSeconds: ts},
+		}, nil)
+		return st.GetSnapshot()["sid1"]
+	}
+
+	set(1000, 0)
+	set(2800, 3600)
+	m := set(4600, 7200)
+	if len(m.UsageRates) != 1 || m.UsageRates[0].BytesPerSecond != 2 {
+		t.Errorf("Expected a rate of 2 B/s, got %+v", m.UsageRates)
+	}
+
+	// A traffic reset is counted and does not break the rate
+	m = set(5500, 1800)
+	if m.Resets != 1 || m.DownloadBytesTotal() != 9000 {
+		t.Errorf("Expected 1 reset and 9000 total bytes, got %d and %d", m.Resets, m.DownloadBytesTotal())
+	}
+	if len(m.UsageRates) != 1 || m.UsageRates[0].BytesPerSecond != 2 {
+		t.Errorf("Expected the rate to continue across the reset, got %+v", m.UsageRates)
+	}
+
+	// Samples older than the longest window are dropped
+	set(8000, 2000)
+	set(9500, 2100)
+	if got := len(st.history["sid1"]); got != 2 {
+		t.Errorf("Expected 2 samples in history, got %d", got)
+	}
+
+	// Counters survive a save and load
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := st.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	restored := New()
+	if _, err := restored.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if m := restored.GetSnapshot()["sid1"]; m.DownloadOffsetBytes != 7200 || m.Resets != 1 {
+		t.Errorf("Expected restored offset 7200 and 1 reset, got %d and %d", m.DownloadOffsetBytes, m.Resets)
+	}
+}
+
+func TestUpdateTarget(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	st := New()
+	st.SetGracePeriod(5 * time.Minute)
+	st.UpdateTarget(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "a", Up: true, DownloadBytes: 100, LastSuccessTimestampSeconds: now},
+		"sid2": {SID: "sid2", Target: "a", Up: true, LastSuccessTimestampSeconds: now - 600},
+	}, TargetStatus{Target: "a", Up: true})
+	st.UpdateTarget(map[string]compute.SubscriptionMetrics{
+		"sid3": {SID: "sid3", Target: "b", Up: true, LastSuccessTimestampSeconds: now},
+	}, TargetStatus{Target: "b", Up: true})
+
+	// Target a fails: sid1 is carried forward, sid2 is past the grace period
+	st.UpdateTarget(map[string]compute.SubscriptionMetrics{}, TargetStatus{Target: "a", Reason: ReasonNetwork})
+
+	snapshot := st.GetSnapshot()
+	if m := snapshot["sid1"]; !m.Stale || m.DownloadBytes != 100 {
+		t.Errorf("Expected sid1 to be carried forward as stale, got %+v", m)
+	}
+	if _, ok := snapshot["sid2"]; ok {
+		t.Error("Expected sid2 to be dropped after the grace period")
+	}
+	if m := snapshot["sid3"]; !m.Up {
+		t.Errorf("Expected sid3 of target b to be untouched, got %+v", m)
+	}
+
+	targets := st.GetTargets()
+	if len(targets) != 2 || targets[0].Target != "a" || targets[0].Up || targets[1].Target != "b" {
+		t.Errorf("Expected statuses [a (down), b], got %+v", targets)
+	}
+
+	taken := st.UpdateTarget(map[string]compute.SubscriptionMetrics{
+		"sid3": {SID: "sid3", Target: "a", Up: true, LastSuccessTimestampSeconds: now},
+	}, TargetStatus{Target: "a", Up: true})
+	if len(taken) != 1 || taken[0] != "sid3" {
+		t.Errorf("Expected sid3 to be taken from target b, got %v", taken)
+	}
+}
+
+func TestDropSubscriptions(t *testing.T) {
+	st := New()
+	st.SetSnapshot(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "a"},
+		"sid2": {SID: "sid2", Target: "b"},
+	}, []TargetStatus{{Target: "a"}, {Target: "b"}})
+
+	if dropped := st.DropSubscriptions(map[string]bool{"a": true}); dropped != 1 {
+		t.Errorf("Expected 1 dropped subscription, got %d", dropped)
+	}
+
+	snapshot := st.GetSnapshot()
+	if _, ok := snapshot["sid1"]; ok {
+		t.Error("Expected sid1 to be dropped")
+	}
+	if _, ok := snapshot["sid2"]; !ok {
+		t.Error("Expected sid2 to be kept")
+	}
+
+	if targets := st.GetTargets(); len(targets) != 2 {
+		t.Errorf("Expected both target statuses to be kept, got %+v", targets)
+	}
+}
+
+func TestUpdateTarget_KeepsCertExpiryOnFailure(t *testing.T) {
+	st := New()
+	st.UpdateTarget(nil, TargetStatus{Target: "a", Up: true, TLSCertExpiryTimestampSeconds: 1700000000})
+	st.UpdateTarget(nil, TargetStatus{Target: "a", Reason: ReasonNetwork})
+
+	if got := st.GetTargets()[0].TLSCertExpiryTimestampSeconds; got != 1700000000 {
+		t.Errorf("Expected the last known certificate expiry to be kept, got %f", got)
+	}
+
+	st.UpdateTarget(nil, TargetStatus{Target: "a", Up: true})
+	if got := st.GetTargets()[0].TLSCertExpiryTimestampSeconds; got != 0 {
+		t.Errorf("Expected a successful plain refresh to clear the expiry, got %f", got)
+	}
+}
+
+func TestUpdateTarget_GraceCountsFromMissedRefresh(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	// Refreshed every 10m: the failed refresh comes 10m after the last success
+	st := New()
+	st.SetGracePeriod(5 * time.Minute)
+	st.UpdateTarget(map[string]compute.SubscriptionMetrics{
+		"sid1": {SID: "sid1", Target: "a", Up: true, LastSuccessTimestampSeconds: now - 600},
+		"sid2": {SID: "sid2", Target: "a", Up: true, LastSuccessTimestampSeconds: now - 1200},
+	}, TargetStatus{Target: "a", Up: true, RefreshInterval: 10 * time.Minute})
+
+	st.UpdateTarget(map[string]compute.SubscriptionMetrics{}, TargetStatus{Target: "a", Reason: ReasonNetwork, RefreshInterval: 10 * time.Minute})
+
+	snapshot := st.GetSnapshot()
+	if m, ok := snapshot["sid1"]; !ok || !m.Stale {
+		t.Errorf("Expected sid1 to be carried forward after its first missed refresh, got %+v", m)
+	}
+	if _, ok := snapshot["sid2"]; ok {
+		t.Error("Expected sid2 to be dropped once the grace period after its missed refresh is over")
+	}
+}
@@ -0,0 +1,57 @@
+// Package version holds build information injected at build time with
+//
+//	go build -ldflags "-X github.com/methol/xui-exporter/internal/version.Version=v1.2.3 -X github.com/methol/xui-exporter/internal/version.Revision=abc1234"
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time via -ldflags -X
+var (
+	Version   = "dev"
+	Revision  = ""
+	BuildDate = ""
+)
+
+// Info is the build information served by /version
+type Info struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information. Without an injected revision, the VCS
+// revision recorded by the Go toolchain is used when available.
+func Get() Info {
+	revision := Revision
+	if revision == "" {
+		revision = vcsRevision()
+	}
+	if revision == "" {
+		revision = "unknown"
+	}
+
+	return Info{
+		Version:   Version,
+		Revision:  revision,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// vcsRevision returns the vcs.revision build setting, if any
+func vcsRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}